@@ -0,0 +1,35 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrClosed is returned when reading from a Reader after Reader.Close.
+var ErrClosed = errors.New("zipstream: reader is closed")
+
+// WithOwnedSource makes Reader.Close close the source if it implements
+// io.Closer, such as an *os.File or an http.Response body, tying its lifetime
+// to the Reader.
+func WithOwnedSource() Option {
+	return func(z *Reader) {
+		z.ownSource = true
+	}
+}
+
+// Close closes the Reader: GetNextEntry then fails with ErrClosed, as do the
+// reads of the current entry needing more data from the source. With
+// WithOwnedSource the source is closed as well, which also unblocks a read of
+// the source in progress in another goroutine, e.g. one copying the reader
+// returned by Entry.OpenRaw. Close may be called more than once, the
+// following calls do nothing and return nil.
+func (z *Reader) Close() error {
+	if !atomic.CompareAndSwapInt32(&z.src.closed, 0, 1) {
+		return nil
+	}
+	if c, ok := z.src.r.(io.Closer); ok && z.ownSource {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOwnedSourceFile(t *testing.T) {
+	f, err := os.Open("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := NewReader(f, WithOwnedSource())
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing again is safe
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected the file to be closed, got %v", err)
+	}
+
+	// the source isn't owned by default
+	f, err = os.Open("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z = NewReader(f)
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("expected the file to be open, got %v", err)
+	}
+}
+
+func TestOwnedSourcePipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		// the entry data never comes
+		pw.Write(rawFileHeader(&zip.FileHeader{
+			Name:             "stalled.bin",
+			ReaderVersion:    20,
+			ModifiedDate:     0x5021,
+			CompressedSize:   1 << 20,
+			UncompressedSize: 1 << 20,
+		}))
+	}()
+
+	z := NewReader(pr, WithOwnedSource())
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := entry.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := io.Copy(io.Discard, r)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("the read returned before Close: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected the read to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't unblock the read")
+	}
+}
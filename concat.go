@@ -0,0 +1,41 @@
+package zipstream
+
+import (
+	"fmt"
+	"io"
+)
+
+// WithConcatenatedArchives reads a stream of archives written back to back.
+// The central directory and the end of central directory record of each
+// archive are parsed to their end, after which the entries of the next
+// archive are read. Entry.ArchiveIndex tells the archives apart and a
+// WarnArchiveBoundary warning is recorded at the start of each following
+// archive. The stream may end after any end of central directory record.
+func WithConcatenatedArchives() Option {
+	return func(z *Reader) {
+		z.concatenated = true
+	}
+}
+
+// nextArchive consumes the central directory of the current archive, whose
+// first signature sig has been read, and reads the first entry of the next
+// archive.
+func (z *Reader) nextArchive(sig uint32) (*Entry, error) {
+	if sig == directoryHeaderSignature {
+		var err error
+		if sig, err = z.readCentralDirectory(); err != nil {
+			return nil, fmt.Errorf("unable to read central directory: %w", err)
+		}
+	}
+	if err := z.readDirectoryEnd(sig); err != nil {
+		return nil, fmt.Errorf("unable to read end of central directory: %w", err)
+	}
+	z.archiveIndex++
+	z.archiveStart = z.offset()
+	if _, err := z.r.Peek(1); err == io.EOF {
+		z.localFileEnd = true
+		return nil, z.endOfEntries()
+	}
+	z.warn(WarnArchiveBoundary, z.offset(), "archive %d starts", z.archiveIndex)
+	return z.GetNextEntry()
+}
@@ -0,0 +1,114 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestConcatenatedArchives(t *testing.T) {
+	var stream []byte
+	var expected []string
+	for i, names := range [][]string{{"a.log", "b.log"}, {}, {"c.log"}} {
+		archive := buildZip(t, func(zw *zip.Writer) error {
+			for _, name := range names {
+				w, err := zw.Create(name)
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return zw.SetComment(fmt.Sprintf("archive %d", i))
+		})
+		stream = append(stream, archive...)
+		for _, name := range names {
+			expected = append(expected, fmt.Sprintf("%d:%s", i, name))
+		}
+	}
+
+	for _, opts := range [][]Option{
+		{WithConcatenatedArchives()},
+		{WithConcatenatedArchives(), WithCentralDirectory()},
+	} {
+		z := NewReader(bytes.NewReader(stream), opts...)
+		var got []string
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unable to get next entry: %s", err)
+			}
+			if s, err := entry.OpenString(); err != nil || s != entry.Name {
+				t.Fatalf("read entry %s fail: %v", entry.Name, err)
+			}
+			got = append(got, fmt.Sprintf("%d:%s", entry.ArchiveIndex, entry.Name))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		var boundaries int
+		for _, w := range z.Warnings() {
+			if w.Code == WarnArchiveBoundary {
+				boundaries++
+			}
+		}
+		if boundaries != 2 {
+			t.Fatalf("expected 2 archive boundaries, got %v", z.Warnings())
+		}
+	}
+
+	// without the option the iteration ends with the first archive
+	z := NewReader(bytes.NewReader(stream))
+	n := 0
+	for ; ; n++ {
+		if _, err := z.GetNextEntry(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+}
+
+func TestConcatenatedZip64Archives(t *testing.T) {
+	archive := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("a.log")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("a.log"))
+		return err
+	})
+	// insert a zip64 end of central directory record, with 4 bytes of
+	// extensible data, and its locator before the regular record
+	end := bytes.LastIndex(archive, []byte{0x50, 0x4b, 0x05, 0x06})
+	var zip64End bytes.Buffer
+	zip64End.Write([]byte{0x50, 0x4b, 0x06, 0x06})
+	zip64End.Write([]byte{48, 0, 0, 0, 0, 0, 0, 0})
+	zip64End.Write(make([]byte, 48))
+	zip64End.Write([]byte{0x50, 0x4b, 0x06, 0x07})
+	zip64End.Write(make([]byte, 16))
+	archive = append(append(append([]byte(nil), archive[:end]...), zip64End.Bytes()...), archive[end:]...)
+
+	z := NewReader(bytes.NewReader(append(append([]byte(nil), archive...), archive...)), WithConcatenatedArchives())
+	for i := 0; i < 2; i++ {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if entry.Name != "a.log" || entry.ArchiveIndex != i {
+			t.Fatalf("unexpected entry %s of archive %d", entry.Name, entry.ArchiveIndex)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
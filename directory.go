@@ -0,0 +1,383 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	directoryHeaderLen      = 42 // directory header without the signature
+	directoryEndLen         = 18 // end of central directory record without the signature
+	directory64EndSignature = 0x06064b50
+	directory64EndLen       = 44 // zip64 end of central directory record without the signature and the record size
+	directory64LocSignature = 0x07064b50
+	directory64LocLen       = 16 // zip64 end of central directory locator without the signature
+)
+
+// ErrInterleavedRecords is returned when a local file header follows a central
+// directory record, which hides the entry from either the streaming parsers or
+// the parsers reading the central directory.
+var ErrInterleavedRecords = errors.New("zipstream: local file header within the central directory")
+
+// ErrCentralDirNotFound is returned by Reader.RecoveredDirectory when no
+// central directory record is found in the rest of the stream.
+var ErrCentralDirNotFound = errors.New("zipstream: central directory not found")
+
+// DirectoryEntry is a record of the central directory.
+type DirectoryEntry struct {
+	zip.FileHeader
+	HeaderOffset int64 // offset of the local file header
+}
+
+// WithCentralDirectory reads the central directory once the local entries
+// end, and completes the entries read with the fields only recorded there,
+// such as CreatorVersion, ExternalAttrs and Comment. The entries are retained
+// by the Reader until then.
+func WithCentralDirectory() Option {
+	return func(z *Reader) {
+		z.readCentralDir = true
+	}
+}
+
+// CentralDirectory returns the central directory records, they are only read
+// with WithCentralDirectory once the local entries have been read.
+func (z *Reader) CentralDirectory() []DirectoryEntry {
+	return z.centralDir
+}
+
+// Comment returns the archive comment recorded in the end of central
+// directory record, which is only read with WithCentralDirectory or
+// WithConcatenatedArchives once the local entries have been read. With
+// concatenated archives it is the comment of the last archive read.
+func (z *Reader) Comment() string {
+	return z.comment
+}
+
+// readCentralDirectory reads the central directory records, the signature of
+// the first one has been read. The records are retained with
+// WithCentralDirectory. It returns the signature of the record following the
+// central directory.
+func (z *Reader) readCentralDirectory() (uint32, error) {
+	start := len(z.centralDir)
+	for {
+		d, err := z.readDirectoryHeader()
+		if err != nil {
+			return 0, err
+		}
+		if z.readCentralDir {
+			z.centralDir = append(z.centralDir, d)
+		}
+
+		buf := make([]byte, headerIdentifierLen)
+		if _, err := io.ReadFull(z.r, buf); err != nil {
+			return 0, z.truncated(err, structCentralDir)
+		}
+		sig := binary.LittleEndian.Uint32(buf)
+		if sig == directoryEndSignature || sig == directory64EndSignature {
+			if z.readCentralDir {
+				if missing := z.completeEntries(z.centralDir[start:]); missing != "" && z.strict {
+					return 0, &FormatError{
+						Name:   missing,
+						Offset: z.offset() - headerIdentifierLen,
+						Msg:    "central directory record without local file header",
+					}
+				}
+			}
+			return sig, nil
+		}
+		if sig == fileHeaderSignature {
+			// a local entry hidden from the streaming parsers
+			z.interleavedOffset = z.offset() - headerIdentifierLen
+			if z.readCentralDir {
+				z.completeEntries(z.centralDir[start:])
+			}
+			return 0, fmt.Errorf("%w: local file header at offset %d", ErrInterleavedRecords, z.interleavedOffset)
+		}
+		if sig != directoryHeaderSignature {
+			return 0, zip.ErrFormat
+		}
+	}
+}
+
+func (z *Reader) readDirectoryHeader() (DirectoryEntry, error) {
+	var d DirectoryEntry
+	buf := make([]byte, directoryHeaderLen)
+	if _, err := io.ReadFull(z.r, buf); err != nil {
+		return d, z.truncated(err, structCentralDir)
+	}
+	b := readBuf(buf)
+	d.CreatorVersion = b.uint16()
+	d.ReaderVersion = b.uint16()
+	d.Flags = b.uint16()
+	d.Method = b.uint16()
+	d.ModifiedTime = b.uint16()
+	d.ModifiedDate = b.uint16()
+	d.CRC32 = b.uint32()
+	d.CompressedSize = b.uint32()
+	d.UncompressedSize = b.uint32()
+	d.CompressedSize64 = uint64(d.CompressedSize)
+	d.UncompressedSize64 = uint64(d.UncompressedSize)
+	filenameLen := int(b.uint16())
+	extraLen := int(b.uint16())
+	commentLen := int(b.uint16())
+	b.uint16() // disk number start (ignored)
+	b.uint16() // internal file attributes (ignored)
+	d.ExternalAttrs = b.uint32()
+	d.HeaderOffset = int64(b.uint32())
+
+	d.NonUTF8 = d.Flags&0x800 == 0
+	d.Modified = MSDosTimeToTime(d.ModifiedDate, d.ModifiedTime)
+
+	variable := make([]byte, filenameLen+extraLen+commentLen)
+	if _, err := io.ReadFull(z.r, variable); err != nil {
+		return d, z.truncated(err, structCentralDir)
+	}
+	d.Name = string(variable[:filenameLen])
+	d.Extra = variable[filenameLen : filenameLen+extraLen]
+	d.Comment = string(variable[filenameLen+extraLen:])
+
+	needUSize := d.UncompressedSize == ^uint32(0)
+	needCSize := d.CompressedSize == ^uint32(0)
+	needHeaderOffset := d.HeaderOffset == int64(^uint32(0))
+
+	var extModified time.Time
+	extra := readBuf(d.Extra)
+	for len(extra) >= 4 { // need at least tag and size
+		fieldTag := extra.uint16()
+		fieldSize := int(extra.uint16())
+		if len(extra) < fieldSize {
+			break
+		}
+		fieldBuf := extra.sub(fieldSize)
+		if fieldTag == ExtTimeExtraID {
+			// Unlike the local variant, the central variant only holds
+			// the modification time, even if the flags announce the
+			// access and creation times as well.
+			if len(fieldBuf) >= 5 && fieldBuf.uint8()&1 != 0 {
+				extModified = time.Unix(int64(fieldBuf.uint32()), 0)
+			}
+			continue
+		}
+		if fieldTag != Zip64ExtraID {
+			continue
+		}
+		// The zip64 values are only present for the fields maxed out
+		// in the directory header, in this order.
+		if needUSize {
+			needUSize = false
+			if len(fieldBuf) < 8 {
+				return d, zip.ErrFormat
+			}
+			d.UncompressedSize64 = fieldBuf.uint64()
+		}
+		if needCSize {
+			needCSize = false
+			if len(fieldBuf) < 8 {
+				return d, zip.ErrFormat
+			}
+			d.CompressedSize64 = fieldBuf.uint64()
+		}
+		if needHeaderOffset {
+			needHeaderOffset = false
+			if len(fieldBuf) < 8 {
+				return d, zip.ErrFormat
+			}
+			d.HeaderOffset = int64(fieldBuf.uint64())
+		}
+	}
+	if needCSize || needHeaderOffset {
+		return d, fmt.Errorf("missing zip64 extra field of directory entry %q: %w", d.Name, zip.ErrFormat)
+	}
+	if !extModified.IsZero() {
+		// as for the local header, see readEntry
+		d.Modified = extModified.UTC()
+		if d.ModifiedTime != 0 || d.ModifiedDate != 0 {
+			d.Modified = extModified.In(timeZone(MSDosTimeToTime(d.ModifiedDate, d.ModifiedTime).Sub(extModified)))
+		}
+	}
+	return d, nil
+}
+
+// completeEntries copies the fields only recorded in the central directory
+// records to the entries read. The records are matched by position, or by
+// name if the central directory is ordered differently than the local
+// entries. It returns the name of the first record without local entry, if
+// any.
+func (z *Reader) completeEntries(records []DirectoryEntry) (missing string) {
+	for _, e := range z.entries {
+		z.localRecords = append(z.localRecords, localRecord{
+			Name:               e.Name,
+			CRC32:              e.CRC32,
+			CompressedSize64:   e.CompressedSize64,
+			UncompressedSize64: e.UncompressedSize64,
+			HeaderOffset:       e.headerOffset - z.archiveStart,
+		})
+	}
+	var byName map[string]*Entry
+	for i := range records {
+		d := &records[i]
+		var entry *Entry
+		if i < len(z.entries) && z.entries[i].Name == d.Name {
+			entry = z.entries[i]
+		} else {
+			if byName == nil {
+				byName = make(map[string]*Entry, len(z.entries))
+				for _, e := range z.entries {
+					byName[e.Name] = e
+				}
+			}
+			if entry = byName[d.Name]; entry == nil {
+				if missing == "" {
+					missing = d.Name
+				}
+				continue
+			}
+		}
+		entry.CreatorVersion = d.CreatorVersion
+		entry.ExternalAttrs = d.ExternalAttrs
+		entry.hasDirAttrs = true
+		entry.Comment = d.Comment
+	}
+	z.entries = nil
+	return missing
+}
+
+// readDirectoryEnd reads the end of central directory records, the signature
+// sig of the first one has been read. The zip64 end of central directory
+// record and its locator precede the regular record of a zip64 archive, only
+// the archive comment of the regular record is retained.
+func (z *Reader) readDirectoryEnd(sig uint32) error {
+	if sig == directory64EndSignature {
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(z.r, buf); err != nil {
+			return z.truncated(err, structCentralDir)
+		}
+		// the record size excludes the signature and the size itself
+		if err := z.discard(int64(binary.LittleEndian.Uint64(buf))); err != nil {
+			return err
+		}
+		if err := z.expectSignature(directory64LocSignature); err != nil {
+			return err
+		}
+		if err := z.discard(directory64LocLen); err != nil {
+			return err
+		}
+		if err := z.expectSignature(directoryEndSignature); err != nil {
+			return err
+		}
+	} else if sig != directoryEndSignature {
+		return zip.ErrFormat
+	}
+	buf := make([]byte, directoryEndLen)
+	if _, err := io.ReadFull(z.r, buf); err != nil {
+		return z.truncated(err, structCentralDir)
+	}
+	comment := make([]byte, binary.LittleEndian.Uint16(buf[directoryEndLen-2:]))
+	if _, err := io.ReadFull(z.r, comment); err != nil {
+		return z.truncated(err, structCentralDir)
+	}
+	z.comment = string(comment)
+	return nil
+}
+
+func (z *Reader) expectSignature(sig uint32) error {
+	buf := make([]byte, headerIdentifierLen)
+	if _, err := io.ReadFull(z.r, buf); err != nil {
+		return z.truncated(err, structCentralDir)
+	}
+	if binary.LittleEndian.Uint32(buf) != sig {
+		return zip.ErrFormat
+	}
+	return nil
+}
+
+// discard discards n bytes of the central directory.
+func (z *Reader) discard(n int64) error {
+	if _, err := io.CopyN(io.Discard, z.r, n); err != nil {
+		return z.truncated(err, structCentralDir)
+	}
+	return nil
+}
+
+// RecoveredDirectory recovers the listing of an archive whose local entries
+// can't be read, e.g. after GetNextEntry failed on a damaged local file
+// header. It discards the stream up to the first plausible central directory
+// record and returns the records read from there, which hold the names,
+// sizes, CRC32s and the header offsets to read the entries from a seekable
+// copy. The local entries are not read anymore. The records read before an
+// error are returned with it.
+func (z *Reader) RecoveredDirectory() ([]DirectoryEntry, error) {
+	z.localFileEnd = true
+	if err := z.scanDirectory(); err != nil {
+		return nil, err
+	}
+	var records []DirectoryEntry
+	for {
+		buf, _ := z.r.Peek(headerIdentifierLen)
+		if len(buf) < headerIdentifierLen || binary.LittleEndian.Uint32(buf) != directoryHeaderSignature {
+			// the records end
+			return records, nil
+		}
+		if _, err := z.r.Discard(headerIdentifierLen); err != nil {
+			return records, err
+		}
+		d, err := z.readDirectoryHeader()
+		if err != nil {
+			return records, err
+		}
+		records = append(records, d)
+	}
+}
+
+// scanDirectory discards the stream up to the first plausible central
+// directory record.
+func (z *Reader) scanDirectory() error {
+	sig := []byte{0x50, 0x4b, 0x01, 0x02}
+	for {
+		buf, err := z.r.Peek(z.r.Size())
+		if i := bytes.Index(buf, sig); i >= 0 {
+			if _, err := z.r.Discard(i); err != nil {
+				return err
+			}
+			header, _ := z.r.Peek(headerIdentifierLen + directoryHeaderLen)
+			if len(header) == headerIdentifierLen+directoryHeaderLen && isDirectoryHeader(header) {
+				return nil
+			}
+			// a signature within the entry data
+			if _, err := z.r.Discard(1); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == io.EOF {
+			return ErrCentralDirNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// keep the bytes which may start a signature
+		if _, err := z.r.Discard(len(buf) - len(sig) + 1); err != nil {
+			return err
+		}
+	}
+}
+
+// isDirectoryHeader reports whether buf starts with a central directory
+// record whose fixed fields look sane.
+func isDirectoryHeader(buf readBuf) bool {
+	if buf.uint32() != directoryHeaderSignature {
+		return false
+	}
+	buf.uint16() // version made by
+	readerVersion := buf.uint16()
+	buf.uint16() // flags
+	method := buf.uint16()
+	buf.sub(16) // modified time and date, crc32, sizes
+	filenameLen := buf.uint16()
+	return readerVersion&0xff <= maxReaderVersion && method <= 99 && filenameLen > 0
+}
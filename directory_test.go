@@ -0,0 +1,340 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCentralDirectory(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile), WithCentralDirectory())
+	var entries []*Entry
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	dir := z.CentralDirectory()
+	if len(dir) != len(az.File) || len(entries) != len(az.File) {
+		t.Fatalf("expected %d directory records, got %d", len(az.File), len(dir))
+	}
+	for i, zf := range az.File {
+		d := dir[i]
+		offset, err := zf.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name != zf.Name || d.CRC32 != zf.CRC32 || d.CompressedSize64 != zf.CompressedSize64 ||
+			d.UncompressedSize64 != zf.UncompressedSize64 || d.ExternalAttrs != zf.ExternalAttrs ||
+			d.CreatorVersion != zf.CreatorVersion || d.HeaderOffset != offset-30-int64(len(zf.Name))-int64(len(entries[i].Extra)) {
+			t.Fatalf("directory record %s is incorrect", d.Name)
+		}
+		if !d.Modified.Equal(zf.Modified) {
+			t.Fatalf("directory record %s: expected modification time %v, got %v", d.Name, zf.Modified, d.Modified)
+		}
+		if entries[i].ExternalAttrs != zf.ExternalAttrs || entries[i].CreatorVersion != zf.CreatorVersion {
+			t.Fatalf("entry %s is not completed from the central directory", zf.Name)
+		}
+	}
+}
+
+func TestCentralExtendedTimestamp(t *testing.T) {
+	modified := time.Date(2022, time.March, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		name     string
+		field    []byte // the body of the 0x5455 field
+		modified time.Time
+	}{
+		// the flags announce the access and creation times, which only the
+		// local variant holds
+		{"all flags", []byte{7, 0, 0, 0, 0}, modified},
+		{"modification time", []byte{1, 0, 0, 0, 0}, modified},
+		{"flags only", []byte{6}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			field := append([]byte(nil), test.field...)
+			if len(field) == 5 {
+				binary.LittleEndian.PutUint32(field[1:], uint32(modified.Unix()))
+			}
+			extra := make([]byte, 4, 4+len(field))
+			binary.LittleEndian.PutUint16(extra, ExtTimeExtraID)
+			binary.LittleEndian.PutUint16(extra[2:], uint16(len(field)))
+			extra = append(extra, field...)
+			zipFile := buildZip(t, func(zw *zip.Writer) error {
+				_, err := zw.CreateRaw(&zip.FileHeader{Name: "a.txt", Extra: extra})
+				return err
+			})
+
+			z := NewReader(bytes.NewReader(zipFile), WithCentralDirectory())
+			for {
+				if _, err := z.GetNextEntry(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := z.CentralDirectory()
+			if len(dir) != 1 {
+				t.Fatalf("expected 1 directory record, got %d", len(dir))
+			}
+			expected := test.modified
+			if expected.IsZero() {
+				expected = MSDosTimeToTime(0, 0)
+			}
+			if !dir[0].Modified.Equal(expected) {
+				t.Fatalf("expected modification time %v, got %v", expected, dir[0].Modified)
+			}
+		})
+	}
+}
+
+func TestDOSAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, fh := range []*zip.FileHeader{
+		{Name: "hidden.txt", Method: zip.Deflate, ExternalAttrs: 0x01 | 0x02 | 0x20},
+		{Name: "system.txt", Method: zip.Deflate, ExternalAttrs: 0x04},
+		{Name: "plain.txt", Method: zip.Deflate},
+	} {
+		if _, err := zw.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(buf.Bytes()), WithCentralDirectory())
+	var entries []*Entry
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	expected := [][4]bool{
+		{true, true, false, true},
+		{false, false, true, false},
+		{false, false, false, false},
+	}
+	for i, entry := range entries {
+		readonly, hidden, system, archive := entry.DOSAttributes()
+		if [4]bool{readonly, hidden, system, archive} != expected[i] {
+			t.Fatalf("unexpected DOS attributes of %s: %v %v %v %v", entry.Name, readonly, hidden, system, archive)
+		}
+	}
+}
+
+func TestZip64DirectoryEnd(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/zip64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile), WithCentralDirectory())
+	for _, zf := range az.File {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if _, err := entry.Bytes(); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Name != zf.Name || entry.UncompressedSize64 != zf.UncompressedSize64 {
+			t.Fatalf("entry %s differs from archive/zip", zf.Name)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if z.Comment() != az.Comment || z.Comment() != "archive comment of a zip64 archive" {
+		t.Fatalf("unexpected comment %q", z.Comment())
+	}
+	if len(z.CentralDirectory()) != len(az.File) {
+		t.Fatalf("expected %d central directory records, got %d", len(az.File), len(z.CentralDirectory()))
+	}
+
+	// a zip64 archive without entries starts with the zip64 record
+	end := bytes.Index(zipFile, []byte{0x50, 0x4b, 0x06, 0x06})
+	z = NewReader(bytes.NewReader(zipFile[end:]), WithCentralDirectory())
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if z.Comment() != az.Comment {
+		t.Fatalf("unexpected comment %q", z.Comment())
+	}
+}
+
+func TestInterleavedRecords(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	smuggled := buildZip(t, func(zw *zip.Writer) error {
+		_, err := zw.CreateHeader(&zip.FileHeader{Name: "smuggled.txt", Method: zip.Store})
+		return err
+	})
+
+	// a local file header between the two central directory records
+	second := bytes.LastIndex(zipFile, []byte("PK\x01\x02"))
+	local := smuggled[:bytes.Index(smuggled, []byte("PK\x01\x02"))]
+	var crafted []byte
+	crafted = append(crafted, zipFile[:second]...)
+	crafted = append(crafted, local...)
+	crafted = append(crafted, zipFile[second:]...)
+
+	z := NewReader(bytes.NewReader(crafted), WithCentralDirectory())
+	var err error
+	for err == nil {
+		_, err = z.GetNextEntry()
+	}
+	if !errors.Is(err, ErrInterleavedRecords) {
+		t.Fatalf("expected ErrInterleavedRecords, got: %v", err)
+	}
+	discrepancies, err := z.VerifyCentralDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range discrepancies {
+		found = found || d.Field == "local header within central directory" && d.Local == fmt.Sprintf("offset %d", second)
+	}
+	if !found {
+		t.Fatalf("the interleaved local header is not reported: %v", discrepancies)
+	}
+
+	// the streaming entries end at the first central directory record
+	// without WithCentralDirectory, the smuggled entry is never seen
+	z = NewReader(bytes.NewReader(crafted))
+	for err = nil; err == nil; {
+		_, err = z.GetNextEntry()
+	}
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestCentralRecordWithoutLocalHeader(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "hidden.txt"} {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// drop the local entry of hidden.txt, the central directory still
+	// records it
+	start := bytes.LastIndex(zipFile, []byte("PK\x03\x04"))
+	end := bytes.Index(zipFile, []byte("PK\x01\x02"))
+	crafted := append(append([]byte(nil), zipFile[:start]...), zipFile[end:]...)
+
+	for _, strict := range []bool{false, true} {
+		z := NewReader(bytes.NewReader(crafted), WithCentralDirectory())
+		z.SetStrict(strict)
+		var err error
+		for err == nil {
+			_, err = z.GetNextEntry()
+		}
+		if !strict {
+			if err != io.EOF {
+				t.Fatalf("expected io.EOF outside strict mode, got: %v", err)
+			}
+			continue
+		}
+		var fe *FormatError
+		if !errors.As(err, &fe) || fe.Name != "hidden.txt" {
+			t.Fatalf("expected *FormatError for hidden.txt in strict mode, got: %v", err)
+		}
+	}
+}
+
+func TestRecoveredDirectory(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(az.File) < 3 {
+		t.Fatal("expected an archive of at least 3 entries")
+	}
+
+	// damage the signature of the second local file header
+	second := bytes.Index(zipFile[4:], []byte("PK\x03\x04")) + 4
+	corrupted := append([]byte(nil), zipFile...)
+	corrupted[second+3] = 0xff
+
+	z := NewReader(bytes.NewReader(corrupted))
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err == nil {
+		t.Fatal("expected an error for the damaged local file header")
+	}
+	records, err := z.RecoveredDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(az.File) {
+		t.Fatalf("expected %d records, got %d", len(az.File), len(records))
+	}
+	for i, zf := range az.File {
+		d := records[i]
+		offset, err := zf.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the data follows the local file header at the recorded offset
+		localHeader := zipFile[d.HeaderOffset:]
+		dataOffset := d.HeaderOffset + 30 + int64(binary.LittleEndian.Uint16(localHeader[26:])) + int64(binary.LittleEndian.Uint16(localHeader[28:]))
+		if d.Name != zf.Name || d.CRC32 != zf.CRC32 || d.CompressedSize64 != zf.CompressedSize64 ||
+			d.UncompressedSize64 != zf.UncompressedSize64 || dataOffset != offset {
+			t.Fatalf("record %d differs from archive/zip: %+v", i, d)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the recovery, got: %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(zipFile[:second])).RecoveredDirectory(); err != ErrCentralDirNotFound {
+		t.Fatalf("expected ErrCentralDirNotFound, got: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package zipstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNotDrainable is returned by Reader.Drain when the iteration has not
+// ended at a record, or has ended with an error, or the stream has already
+// been drained.
+var ErrNotDrainable = errors.New("zipstream: the iteration has not ended at a record")
+
+// Drain returns the rest of the stream once GetNextEntry has returned io.EOF:
+// the returned reader starts at the first byte of the record which ended the
+// local entries, usually the central directory, and reads up to the end of
+// the stream. It is not available with WithCentralDirectory, which consumes
+// the central directory, and can only be called once.
+func (z *Reader) Drain() (io.Reader, error) {
+	if !z.drainable {
+		return nil, ErrNotDrainable
+	}
+	z.drainable = false
+	// the signature of the record has been read
+	return io.MultiReader(bytes.NewReader(z.unread), z.r), nil
+}
+
+// endAt ends the iteration at the record whose signature sig has been read,
+// nil at the end of the stream, so that the stream can be drained.
+func (z *Reader) endAt(sig []byte) error {
+	err := z.endOfEntries()
+	if err == io.EOF {
+		z.drainable = true
+		z.unread = sig
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestDrain(t *testing.T) {
+	const comment = "archive comment"
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(bytes.Repeat([]byte(name), 100)); err != nil {
+				return err
+			}
+		}
+		return zw.SetComment(comment)
+	})
+	eocd := zipFile[len(zipFile)-directoryEndLen-headerIdentifierLen-len(comment):]
+	dirOffset := binary.LittleEndian.Uint32(eocd[16:])
+
+	z := NewReader(bytes.NewReader(zipFile))
+	if _, err := z.Drain(); err != ErrNotDrainable {
+		t.Fatalf("expected ErrNotDrainable before the end, got %v", err)
+	}
+	for {
+		_, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := z.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, zipFile[dirOffset:]) {
+		t.Fatalf("expected the %d bytes from offset %d, got %d bytes", len(zipFile)-int(dirOffset), dirOffset, len(rest))
+	}
+	if _, err := z.Drain(); err != ErrNotDrainable {
+		t.Fatalf("expected ErrNotDrainable once drained, got %v", err)
+	}
+
+	// the central directory is consumed
+	z = NewReader(bytes.NewReader(zipFile), WithCentralDirectory())
+	for {
+		if _, err := z.GetNextEntry(); err != nil {
+			break
+		}
+	}
+	if _, err := z.Drain(); err != ErrNotDrainable {
+		t.Fatalf("expected ErrNotDrainable, got %v", err)
+	}
+
+	// the iteration ended with an error
+	z = NewReader(bytes.NewReader(zipFile))
+	z.ExpectEntries(3)
+	for {
+		if _, err := z.GetNextEntry(); err != nil {
+			break
+		}
+	}
+	if _, err := z.Drain(); err != ErrNotDrainable {
+		t.Fatalf("expected ErrNotDrainable after an error, got %v", err)
+	}
+}
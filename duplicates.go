@@ -0,0 +1,121 @@
+package zipstream
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DuplicateMode selects how WithDuplicateDetection compares the entry names.
+type DuplicateMode int
+
+const (
+	// DuplicateExact detects the entries with identical names.
+	DuplicateExact DuplicateMode = iota + 1
+	// DuplicateFoldCase also detects the names differing only by case,
+	// which collide on the case-insensitive file systems of Windows and
+	// macOS.
+	DuplicateFoldCase
+	// DuplicateFoldUnicode also detects the names differing only by the
+	// composition of accented Latin letters, such as "é" written as one
+	// precomposed code point (NFC) or as "e" and a combining accent (NFD),
+	// which collide on macOS.
+	DuplicateFoldUnicode
+)
+
+// WithDuplicateDetection detects the entries whose name collides with the
+// name of a previous entry as compared by mode. A colliding entry gets a
+// WarnDuplicateName warning, in strict mode GetNextEntry returns a
+// *FormatError instead, before any of its data is read.
+//
+// The names of all the entries read are retained in a map to compare them,
+// which grows with the number of entries, see NameTableSize.
+func WithDuplicateDetection(mode DuplicateMode) Option {
+	return func(z *Reader) {
+		z.dupMode = mode
+	}
+}
+
+// NameTableSize returns the number of names retained by
+// WithDuplicateDetection.
+func (z *Reader) NameTableSize() int {
+	return len(z.names)
+}
+
+// checkDuplicate records the name of entry, a name colliding with the name of
+// a previous entry is reported as a warning or, in strict mode, as an error.
+func (z *Reader) checkDuplicate(entry *Entry) error {
+	if z.dupMode == 0 {
+		return nil
+	}
+	if z.names == nil {
+		z.names = make(map[string]string)
+	}
+	key := foldName(entry.Name, z.dupMode)
+	prev, ok := z.names[key]
+	if !ok {
+		z.names[key] = entry.Name
+		return nil
+	}
+	if z.strict {
+		return &FormatError{
+			Name:   entry.Name,
+			Offset: entry.headerOffset,
+			Msg:    fmt.Sprintf("name colliding with entry %q", prev),
+		}
+	}
+	entry.warn(WarnDuplicateName, entry.headerOffset, "the name collides with entry %q", prev)
+	return nil
+}
+
+// foldName returns the key of name compared by mode.
+func foldName(name string, mode DuplicateMode) string {
+	if mode >= DuplicateFoldUnicode {
+		name = composeLatin(name)
+	}
+	if mode >= DuplicateFoldCase {
+		name = strings.Map(func(r rune) rune {
+			return unicode.ToLower(unicode.ToUpper(r))
+		}, name)
+	}
+	return name
+}
+
+// latinCompositions maps the combining marks to the ASCII letters they
+// compose with and to the resulting precomposed letters of the Latin-1
+// Supplement and Latin Extended-A blocks.
+var latinCompositions = map[rune]struct{ bases, composed string }{
+	0x0300: {"AEIOUaeiou", "ÀÈÌÒÙàèìòù"},                             // combining grave accent
+	0x0301: {"AEIOUYaeiouyCcLlNnRrSsZz", "ÁÉÍÓÚÝáéíóúýĆćĹĺŃńŔŕŚśŹź"}, // combining acute accent
+	0x0302: {"AEIOUaeiouCcGgHhJjSsWwYy", "ÂÊÎÔÛâêîôûĈĉĜĝĤĥĴĵŜŝŴŵŶŷ"}, // combining circumflex accent
+	0x0303: {"ANOanoIiUu", "ÃÑÕãñõĨĩŨũ"},                             // combining tilde
+	0x0304: {"AaEeIiOoUu", "ĀāĒēĪīŌōŪū"},                             // combining macron
+	0x0306: {"AaEeGgIiOoUu", "ĂăĔĕĞğĬĭŎŏŬŭ"},                         // combining breve
+	0x0307: {"CcEeGgIZz", "ĊċĖėĠġİŻż"},                               // combining dot above
+	0x0308: {"AEIOUaeiouyY", "ÄËÏÖÜäëïöüÿŸ"},                         // combining diaeresis
+	0x030a: {"AaUu", "ÅåŮů"},                                         // combining ring above
+	0x030b: {"OoUu", "ŐőŰű"},                                         // combining double acute accent
+	0x030c: {"CcDdEeLlNnRrSsTtZz", "ČčĎďĚěĽľŇňŘřŠšŤťŽž"},             // combining caron
+	0x0327: {"CcGgKkLlNnRrSsTt", "ÇçĢģĶķĻļŅņŖŗŞşŢţ"},                 // combining cedilla
+	0x0328: {"AaEeIiUu", "ĄąĘęĮįŲų"},                                 // combining ogonek
+}
+
+// composeLatin replaces the ASCII letters followed by a combining mark with the
+// precomposed letter, the canonical composition of NFC restricted to
+// latinCompositions.
+func composeLatin(name string) string {
+	if strings.IndexFunc(name, func(r rune) bool { return unicode.Is(unicode.Mn, r) }) < 0 {
+		return name
+	}
+	runes := make([]rune, 0, len(name))
+	for _, r := range name {
+		if c, ok := latinCompositions[r]; ok && len(runes) > 0 {
+			if i := strings.IndexRune(c.bases, runes[len(runes)-1]); i >= 0 {
+				runes[len(runes)-1] = []rune(c.composed)[i]
+				continue
+			}
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
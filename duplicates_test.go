@@ -0,0 +1,124 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDuplicateDetection(t *testing.T) {
+	names := []string{
+		"Photo.JPG",
+		"photo.jpg",
+		"café.txt",  // NFC
+		"café.txt", // NFD
+		"CAFÉ.TXT",
+		"dir/a.txt",
+		"dir/a.txt",
+		"other.txt",
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range names {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	tests := []struct {
+		mode       DuplicateMode
+		duplicates []bool
+		tableSize  int
+	}{
+		{DuplicateExact, []bool{false, false, false, false, false, false, true, false}, 7},
+		{DuplicateFoldCase, []bool{false, true, false, false, true, false, true, false}, 5},
+		{DuplicateFoldUnicode, []bool{false, true, false, true, true, false, true, false}, 4},
+	}
+	for _, test := range tests {
+		z := NewReader(bytes.NewReader(zipFile), WithDuplicateDetection(test.mode))
+		for i, duplicate := range test.duplicates {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			warned := false
+			for _, w := range entry.Warnings() {
+				warned = warned || w.Code == WarnDuplicateName
+			}
+			if warned != duplicate {
+				t.Errorf("mode %d: entry %d %q: expected duplicate %v, got warnings %v", test.mode, i, entry.Name, duplicate, entry.Warnings())
+			}
+		}
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+		if z.NameTableSize() != test.tableSize {
+			t.Errorf("mode %d: expected %d names retained, got %d", test.mode, test.tableSize, z.NameTableSize())
+		}
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for range names {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range entry.Warnings() {
+			if w.Code == WarnDuplicateName {
+				t.Fatalf("unexpected warning without duplicate detection: %v", w)
+			}
+		}
+	}
+	if z.NameTableSize() != 0 {
+		t.Fatal("no names are retained without duplicate detection")
+	}
+}
+
+func TestDuplicateDetectionStrict(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"README", "readme"} {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile), WithDuplicateDetection(DuplicateFoldCase))
+	z.SetStrict(true)
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := z.GetNextEntry()
+	var fe *FormatError
+	if !errors.As(err, &fe) || !errors.Is(err, zip.ErrFormat) {
+		t.Fatalf("expected *FormatError, got: %v", err)
+	}
+	// the empty deflate stream and the data descriptor end the first entry
+	if fe.Name != "readme" || fe.Offset != int64(30+len("README")+2+16) {
+		t.Fatalf("unexpected format error: %v", fe)
+	}
+	// the data of the rejected entry is skipped
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestComposeLatin(t *testing.T) {
+	for nfd, nfc := range map[string]string{
+		"é":               "é",
+		"Angélique":       "Angélique",
+		"ñö":             "ñö",
+		"́e":               "́e",
+		"x́":               "x́",
+		"Škoda.txt":       "Škoda.txt",
+		"plain/ascii/name": "plain/ascii/name",
+	} {
+		if composed := composeLatin(nfd); composed != nfc {
+			t.Errorf("composeLatin(%+q) = %+q, expected %+q", nfd, composed, nfc)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package zipstream
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The general purpose bit flags of a local file header.
+const (
+	flagEncrypted        = 1 << 0  // traditional PKWARE encryption
+	flagCompressionOpt1  = 1 << 1  // compression option, e.g. deflate level
+	flagCompressionOpt2  = 1 << 2  // compression option, e.g. deflate level
+	flagDataDescriptor   = 1 << 3  // sizes and CRC32 follow the data
+	flagEnhancedDeflate  = 1 << 4  // reserved for enhanced deflating
+	flagPatchData        = 1 << 5  // compressed patched data
+	flagStrongEncryption = 1 << 6  // strong encryption, requires bit 0
+	flagUTF8             = 1 << 11 // name and comment are UTF-8
+	flagMaskedHeader     = 1 << 13 // local header values masked, central directory encrypted
+)
+
+// FlagInfo decodes the general purpose bit flags of an entry.
+type FlagInfo struct {
+	Encrypted        bool   // bit 0
+	CompressionOpt1  bool   // bit 1
+	CompressionOpt2  bool   // bit 2
+	DataDescriptor   bool   // bit 3
+	EnhancedDeflate  bool   // bit 4
+	PatchData        bool   // bit 5
+	StrongEncryption bool   // bit 6
+	UTF8             bool   // bit 11
+	MaskedHeader     bool   // bit 13
+	Reserved         uint16 // the set bits with no defined meaning
+}
+
+func decodeFlags(flags uint16) FlagInfo {
+	return FlagInfo{
+		Encrypted:        flags&flagEncrypted != 0,
+		CompressionOpt1:  flags&flagCompressionOpt1 != 0,
+		CompressionOpt2:  flags&flagCompressionOpt2 != 0,
+		DataDescriptor:   flags&flagDataDescriptor != 0,
+		EnhancedDeflate:  flags&flagEnhancedDeflate != 0,
+		PatchData:        flags&flagPatchData != 0,
+		StrongEncryption: flags&flagStrongEncryption != 0,
+		UTF8:             flags&flagUTF8 != 0,
+		MaskedHeader:     flags&flagMaskedHeader != 0,
+		Reserved: flags &^ (flagEncrypted | flagCompressionOpt1 | flagCompressionOpt2 | flagDataDescriptor |
+			flagEnhancedDeflate | flagPatchData | flagStrongEncryption | flagUTF8 | flagMaskedHeader),
+	}
+}
+
+// FlagInfo returns the decoded general purpose bit flags of the entry.
+func (e *Entry) FlagInfo() FlagInfo {
+	return decodeFlags(e.Flags)
+}
+
+// FlagError is returned by GetNextEntry for an entry whose general purpose
+// bit flags require a feature which is not supported.
+type FlagError struct {
+	Name    string // name of the entry
+	Bits    uint16 // the flag bits requiring the feature
+	Feature string // description of the feature, e.g. "strong encryption"
+}
+
+func (e *FlagError) Error() string {
+	var bits []string
+	for i := uint(0); i < 16; i++ {
+		if e.Bits&(1<<i) != 0 {
+			bits = append(bits, fmt.Sprint(i))
+		}
+	}
+	plural := ""
+	if len(bits) > 1 {
+		plural = "s"
+	}
+	return fmt.Sprintf("zipstream: entry %q uses %s (bit%s %s) which is unsupported", e.Name, e.Feature, plural, strings.Join(bits, " and "))
+}
+
+// checkFlags returns an error for the flag combinations which can't be read.
+// Strong encryption is checked before traditional encryption as it sets bit 0
+// too.
+func (e *Entry) checkFlags() error {
+	fi := e.FlagInfo()
+	switch {
+	case fi.MaskedHeader:
+		return ErrCentralDirEncrypted
+	case fi.StrongEncryption:
+		return &FlagError{Name: e.Name, Bits: flagStrongEncryption, Feature: "strong encryption"}
+	case fi.Encrypted && fi.DataDescriptor:
+		return &FlagError{Name: e.Name, Bits: flagEncrypted | flagDataDescriptor, Feature: "encryption with a data descriptor"}
+	case fi.Encrypted:
+		return &FlagError{Name: e.Name, Bits: flagEncrypted, Feature: "encryption"}
+	case fi.PatchData:
+		return &FlagError{Name: e.Name, Bits: flagPatchData, Feature: "patch data"}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFlagInfo(t *testing.T) {
+	fi := decodeFlags(flagDataDescriptor | flagUTF8 | 1<<15)
+	if !fi.DataDescriptor || !fi.UTF8 || fi.Encrypted || fi.Reserved != 1<<15 {
+		t.Fatalf("unexpected flag info %+v", fi)
+	}
+}
+
+func TestFlagErrors(t *testing.T) {
+	tests := []struct {
+		flags uint16
+		msg   string
+	}{
+		{flagEncrypted, `zipstream: entry "a.txt" uses encryption (bit 0) which is unsupported`},
+		{flagEncrypted | flagDataDescriptor, `zipstream: entry "a.txt" uses encryption with a data descriptor (bits 0 and 3) which is unsupported`},
+		{flagEncrypted | flagStrongEncryption, `zipstream: entry "a.txt" uses strong encryption (bit 6) which is unsupported`},
+		{flagPatchData, `zipstream: entry "a.txt" uses patch data (bit 5) which is unsupported`},
+	}
+	for _, test := range tests {
+		header := rawFileHeader(&zip.FileHeader{
+			Name:          "a.txt",
+			ReaderVersion: 20,
+			Flags:         test.flags,
+			ModifiedDate:  0x5021,
+		})
+		_, err := NewReader(bytes.NewReader(header)).GetNextEntry()
+		var fe *FlagError
+		if !errors.As(err, &fe) {
+			t.Fatalf("flags %#x: expected a FlagError, got %v", test.flags, err)
+		}
+		if fe.Error() != test.msg {
+			t.Fatalf("flags %#x: expected %q, got %q", test.flags, test.msg, fe.Error())
+		}
+	}
+
+	header := rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 20, Flags: flagMaskedHeader})
+	if _, err := NewReader(bytes.NewReader(header)).GetNextEntry(); !errors.Is(err, ErrCentralDirEncrypted) {
+		t.Fatalf("expected ErrCentralDirEncrypted, got %v", err)
+	}
+}
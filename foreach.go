@@ -0,0 +1,32 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrStopIteration is returned by the function passed to Reader.ForEach to
+// stop the iteration without error.
+var ErrStopIteration = errors.New("zipstream: stop iteration")
+
+// ForEach calls fn for each of the remaining entries. fn may open and read
+// the entry or not, its remaining data is skipped before the next entry is
+// read. The iteration stops at the first error returned by fn, which ForEach
+// returns, unless it is ErrStopIteration for which ForEach returns nil.
+func (z *Reader) ForEach(fn func(e *Entry) error) error {
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+}
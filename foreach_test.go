@@ -0,0 +1,96 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestForEach(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i := 0; i < 5; i++ {
+			w, err := zw.Create(fmt.Sprintf("file%d.txt", i))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "contents %d", i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// only the odd entries are read, the others are skipped
+	n := 0
+	err := NewReader(bytes.NewReader(zipFile)).ForEach(func(e *Entry) error {
+		if n%2 == 1 {
+			s, err := e.OpenString()
+			if err != nil {
+				return err
+			}
+			if expected := fmt.Sprintf("contents %d", n); s != expected {
+				return fmt.Errorf("expected %q, got %q", expected, s)
+			}
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 entries, got %d", n)
+	}
+}
+
+func TestForEachStop(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i := 0; i < 5; i++ {
+			if _, err := zw.Create(fmt.Sprintf("file%d.txt", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	n := 0
+	err := z.ForEach(func(e *Entry) error {
+		if n++; n == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+	// the iteration can be resumed
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "file2.txt" {
+		t.Fatalf("expected file2.txt, got %s", entry.Name)
+	}
+
+	errStop := errors.New("stop")
+	err = NewReader(bytes.NewReader(zipFile)).ForEach(func(e *Entry) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("expected the error of fn, got: %v", err)
+	}
+
+	// an error of the archive is returned
+	err = NewReader(bytes.NewReader(zipFile[:60])).ForEach(func(e *Entry) error {
+		return nil
+	})
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated for a truncated archive, got: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzReadEntry(f *testing.F) {
+	seeds, err := filepath.Glob("testdata/*.zip")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range seeds {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, strict := range []bool{false, true} {
+			z := NewReader(bytes.NewReader(data), WithCentralDirectory())
+			z.SetStrict(strict)
+			for i := 0; i < 100; i++ {
+				entry, err := z.GetNextEntry()
+				if err != nil {
+					break
+				}
+				rc, err := entry.Open()
+				if err != nil {
+					continue
+				}
+				// bounded, the sizes may be arbitrary
+				io.Copy(io.Discard, io.LimitReader(rc, 1<<20))
+				rc.Close()
+			}
+			z.VerifyCentralDirectory()
+		}
+
+		// the seekable paths parse the end of central directory records
+		entries, _ := NewReader(bytes.NewReader(data)).SortedEntries()
+		for _, entry := range entries {
+			if rc, err := entry.Open(); err == nil {
+				io.Copy(io.Discard, io.LimitReader(rc, 1<<20))
+				rc.Close()
+			}
+		}
+		NewReader(bytes.NewReader(data)).RecoveredDirectory()
+	})
+}
@@ -0,0 +1,114 @@
+package zipstream
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// listingEntry is the JSON object written by Reader.WriteListingJSON per entry.
+type listingEntry struct {
+	Name             string    `json:"name"`
+	CompressedSize   uint64    `json:"compressedSize"`
+	UncompressedSize uint64    `json:"uncompressedSize"`
+	Method           uint16    `json:"method"`
+	Modified         time.Time `json:"modified"`
+	CRC32            uint32    `json:"crc32"`
+	IsDir            bool      `json:"isDir"`
+}
+
+// WriteListingJSON iterates the remaining entries and writes one JSON object
+// per entry to w as NDJSON, without keeping the listing in memory. The entry
+// data is skipped before the entry is written, so the sizes and CRC32 of
+// entries with data descriptor are the final ones.
+func (z *Reader) WriteListingJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.eof {
+			if err := entry.skip(); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(listingEntry{
+			Name:             entry.Name,
+			CompressedSize:   entry.CompressedSize64,
+			UncompressedSize: entry.UncompressedSize64,
+			Method:           entry.Method,
+			Modified:         entry.Modified,
+			CRC32:            entry.CRC32,
+			IsDir:            entry.IsDir(),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// EntryMetadata is the metadata of an entry in a form suited to JSON, see
+// Entry.Metadata. The values which are not known, such as the sizes of an
+// entry with data descriptor before its data is read, are nil and omitted.
+type EntryMetadata struct {
+	Name                     string     `json:"name"`
+	SanitizedName            string     `json:"sanitizedName"`
+	CompressedSize           *uint64    `json:"compressedSize,omitempty"`
+	UncompressedSize         *uint64    `json:"uncompressedSize,omitempty"`
+	ObservedCompressedSize   *uint64    `json:"observedCompressedSize,omitempty"`
+	ObservedUncompressedSize *uint64    `json:"observedUncompressedSize,omitempty"`
+	Method                   uint16     `json:"method"`
+	MethodName               string     `json:"methodName"`
+	CRC32                    *uint32    `json:"crc32,omitempty"`
+	Modified                 *time.Time `json:"modified,omitempty"`
+	Accessed                 *time.Time `json:"accessed,omitempty"`
+	Created                  *time.Time `json:"created,omitempty"`
+	Encrypted                bool       `json:"encrypted"`
+	Zip64                    bool       `json:"zip64"`
+	DataDescriptor           bool       `json:"dataDescriptor"`
+	Insecure                 bool       `json:"insecure"`
+	UID                      *int       `json:"uid,omitempty"`
+	GID                      *int       `json:"gid,omitempty"`
+}
+
+// Metadata returns the metadata of the entry known so far. The sizes and the
+// CRC32 of an entry with data descriptor are known once its data has been
+// read or skipped, the observed sizes once it has been read with Open.
+func (e *Entry) Metadata() EntryMetadata {
+	m := EntryMetadata{
+		Name:           e.Name,
+		SanitizedName:  sanitizeName(e.Name),
+		Method:         e.Method,
+		MethodName:     MethodName(e.Method),
+		Encrypted:      e.Flags&flagEncrypted != 0,
+		Zip64:          e.zip64,
+		DataDescriptor: e.hasDataDescriptor(),
+		Insecure:       e.Insecure,
+	}
+	if !e.hasDataDescriptor() || e.eof {
+		compressed, uncompressed := e.CompressedSize64, e.UncompressedSize64
+		m.CompressedSize, m.UncompressedSize = &compressed, &uncompressed
+	}
+	if e.crcKnown {
+		crc := e.CRC32
+		m.CRC32 = &crc
+	}
+	if e.summed {
+		compressed, uncompressed := e.ObservedCompressedSize, e.ObservedUncompressedSize
+		m.ObservedCompressedSize, m.ObservedUncompressedSize = &compressed, &uncompressed
+	}
+	if !e.Modified.IsZero() {
+		modified := e.Modified
+		m.Modified = &modified
+	}
+	if _, accessed, created, ok := e.NTFSTimes(); ok {
+		m.Accessed, m.Created = &accessed, &created
+	}
+	if uid, gid, ok := e.Owner(); ok {
+		m.UID, m.GID = &uid, &gid
+	}
+	return m
+}
@@ -0,0 +1,121 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestWriteListingJSON(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/crc_zero.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewReader(bytes.NewReader(zipFile)).WriteListingJSON(&buf); err != nil {
+		t.Fatalf("write listing fail: %s", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var entry listingEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("unmarshal listing line %d fail: %s", i, err)
+		}
+		zf := az.File[i]
+		if entry.Name != zf.Name || entry.CompressedSize != zf.CompressedSize64 ||
+			entry.UncompressedSize != zf.UncompressedSize64 || entry.Method != zf.Method ||
+			!entry.Modified.Equal(zf.Modified) || entry.CRC32 != zf.CRC32 || entry.IsDir != zf.Mode().IsDir() {
+			t.Fatalf("listing line %d is incorrect: %s", i, scanner.Text())
+		}
+	}
+	if i != len(az.File) {
+		t.Fatalf("expected %d listing lines, got %d", len(az.File), i)
+	}
+}
+
+func TestEntryMetadata(t *testing.T) {
+	f, err := os.Open("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	golden, err := os.ReadFile("testdata/example.metadata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(f)
+	var metadata []EntryMetadata
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata = append(metadata, entry.Metadata())
+	}
+	got, err := json.MarshalIndent(metadata, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	if !bytes.Equal(got, golden) {
+		t.Fatalf("metadata differs from testdata/example.metadata.json:\n%s", got)
+	}
+}
+
+func TestEntryMetadataDescriptor(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("a.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("hello, world"))
+		return err
+	})
+
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := entry.Metadata()
+	if !m.DataDescriptor || m.CompressedSize != nil || m.UncompressedSize != nil || m.CRC32 != nil {
+		t.Fatalf("expected unknown sizes and CRC32 before the data is read, got %+v", m)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("Size")) || bytes.Contains(b, []byte("crc32")) {
+		t.Fatalf("expected the unknown fields to be omitted, got %s", b)
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m = entry.Metadata()
+	if m.UncompressedSize == nil || *m.UncompressedSize != 12 || m.CRC32 == nil ||
+		m.ObservedUncompressedSize == nil || *m.ObservedUncompressedSize != 12 {
+		t.Fatalf("expected the sizes and CRC32 once the data is read, got %+v", m)
+	}
+}
@@ -0,0 +1,130 @@
+package zipstream
+
+import "fmt"
+
+// ManifestEntry declares an entry the archive must contain, see WithManifest.
+// The size and the CRC32 are only checked when set.
+type ManifestEntry struct {
+	Name             string
+	UncompressedSize *uint64
+	CRC32            *uint32
+}
+
+// ManifestError describes an entry which doesn't match the manifest set by
+// WithManifest.
+type ManifestError struct {
+	Name     string // name of the entry
+	Field    string // "uncompressed size", "crc32", "duplicate" or "unexpected"
+	Expected string // the value of the manifest, empty for a duplicate or unexpected entry
+	Got      string // the value of the entry, empty for a duplicate or unexpected entry
+}
+
+func (e *ManifestError) Error() string {
+	switch e.Field {
+	case "duplicate":
+		return fmt.Sprintf("zipstream: entry %q matches a manifest entry already seen", e.Name)
+	case "unexpected":
+		return fmt.Sprintf("zipstream: entry %q is not in the manifest", e.Name)
+	}
+	return fmt.Sprintf("zipstream: entry %q has %s %s, the manifest expects %s", e.Name, e.Field, e.Got, e.Expected)
+}
+
+// WithManifest checks the entries against entries as they are read, matching
+// the names once sanitized: the directory separators are slashes and the
+// leading slashes, the "." and the escaping ".." elements are removed. A name
+// declared more than once keeps its first declaration.
+//
+// An entry whose size or CRC32 differs from the manifest, or which matches a
+// manifest entry already seen, gets a WarnManifestMismatch warning, in strict
+// mode GetNextEntry returns a *ManifestError instead. The sizes and the CRC32
+// recorded in the local header are checked by the GetNextEntry returning the
+// entry, those recorded in a data descriptor by the next call, once the data
+// has been read. If strict is set, the entries other than directories which
+// aren't in the manifest are reported alike. Reader.MissingEntries reports the
+// manifest entries not seen.
+func WithManifest(entries []ManifestEntry, strict bool) Option {
+	return func(z *Reader) {
+		z.manifest = nil
+		z.manifestIndex = make(map[string]int, len(entries))
+		for _, m := range entries {
+			name := sanitizeName(m.Name)
+			if _, ok := z.manifestIndex[name]; !ok {
+				z.manifestIndex[name] = len(z.manifest)
+				z.manifest = append(z.manifest, m)
+			}
+		}
+		z.manifestSeen = make([]bool, len(z.manifest))
+		z.manifestStrict = strict
+	}
+}
+
+// MissingEntries returns the entries of the manifest set by WithManifest
+// which no entry read so far matched. Once GetNextEntry has returned io.EOF,
+// they are the entries missing from the archive.
+func (z *Reader) MissingEntries() []ManifestEntry {
+	var missing []ManifestEntry
+	for i, seen := range z.manifestSeen {
+		if !seen {
+			missing = append(missing, z.manifest[i])
+		}
+	}
+	return missing
+}
+
+// checkManifest matches entry with the manifest and checks the values recorded
+// in its local header. The values of an entry with data descriptor are
+// checked by checkManifestData once its data has been read.
+func (z *Reader) checkManifest(entry *Entry) error {
+	if z.manifestIndex == nil {
+		return nil
+	}
+	i, ok := z.manifestIndex[sanitizeName(entry.Name)]
+	switch {
+	case !ok && z.manifestStrict && !entry.IsDir():
+		return z.manifestMismatch(entry, &ManifestError{Name: entry.Name, Field: "unexpected"})
+	case !ok:
+		return nil
+	case z.manifestSeen[i]:
+		return z.manifestMismatch(entry, &ManifestError{Name: entry.Name, Field: "duplicate"})
+	}
+	z.manifestSeen[i] = true
+	entry.manifest = &z.manifest[i]
+	if entry.hasDataDescriptor() {
+		return nil
+	}
+	return z.checkManifestData(entry)
+}
+
+// checkManifestData checks the size and the CRC32 of entry against its
+// manifest entry.
+func (z *Reader) checkManifestData(entry *Entry) error {
+	m := entry.manifest
+	entry.manifest = nil
+	if m.UncompressedSize != nil && *m.UncompressedSize != entry.UncompressedSize64 {
+		return z.manifestMismatch(entry, &ManifestError{
+			Name:     entry.Name,
+			Field:    "uncompressed size",
+			Expected: fmt.Sprint(*m.UncompressedSize),
+			Got:      fmt.Sprint(entry.UncompressedSize64),
+		})
+	}
+	if m.CRC32 != nil && entry.crcKnown && *m.CRC32 != entry.CRC32 {
+		return z.manifestMismatch(entry, &ManifestError{
+			Name:     entry.Name,
+			Field:    "crc32",
+			Expected: fmt.Sprintf("%08x", *m.CRC32),
+			Got:      fmt.Sprintf("%08x", entry.CRC32),
+		})
+	}
+	return nil
+}
+
+// manifestMismatch reports err as a warning of entry or, in strict mode, as
+// an error.
+func (z *Reader) manifestMismatch(entry *Entry, err *ManifestError) error {
+	if z.strict {
+		return err
+	}
+	entry.warn(WarnManifestMismatch, entry.headerOffset, "%s", err.Error())
+	return nil
+}
@@ -0,0 +1,146 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{"a.txt", "hello"},
+		{"b.txt", "hello, world"}, // data descriptor
+		{"dir/", ""},
+		{"c.txt", "not in the manifest"},
+		{"a.txt", "again"},
+		{"sub/e.txt", "sanitized"},
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i, f := range files {
+			var w io.Writer
+			var err error
+			if i == 1 {
+				w, err = zw.Create(f.name)
+			} else {
+				w, err = zw.CreateRaw(&zip.FileHeader{
+					Name:               f.name,
+					ModifiedDate:       0x5021,
+					CRC32:              crc32.ChecksumIEEE([]byte(f.contents)),
+					CompressedSize64:   uint64(len(f.contents)),
+					UncompressedSize64: uint64(len(f.contents)),
+				})
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(f.contents)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	size := func(n uint64) *uint64 { return &n }
+	crc := crc32.ChecksumIEEE([]byte("hello"))
+	manifest := []ManifestEntry{
+		{Name: "./a.txt", UncompressedSize: size(5), CRC32: &crc},
+		{Name: "b.txt", UncompressedSize: size(5)}, // wrong size
+		{Name: "d.txt"}, // missing
+		{Name: `sub\e.txt`},
+		{Name: "d.txt", UncompressedSize: size(1)}, // the first declaration is kept
+	}
+
+	tests := []struct {
+		name       string
+		strict     bool
+		mismatches []string // expected field of the mismatch of each entry, empty if none
+	}{
+		{"partial manifest", false, []string{"", "uncompressed size", "", "", "duplicate", ""}},
+		{"unexpected entries", true, []string{"", "uncompressed size", "", "unexpected", "duplicate", ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the mismatches are warnings
+			z := NewReader(bytes.NewReader(zipFile), WithManifest(manifest, test.strict))
+			var entries []*Entry
+			for {
+				entry, err := z.GetNextEntry()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				entries = append(entries, entry)
+			}
+			for i, entry := range entries {
+				var mismatches []ParseWarning
+				for _, w := range entry.Warnings() {
+					if w.Code == WarnManifestMismatch {
+						mismatches = append(mismatches, w)
+					}
+				}
+				if expected := test.mismatches[i]; (expected == "") != (len(mismatches) == 0) {
+					t.Errorf("entry %d %q: expected mismatch %q, got %v", i, entry.Name, expected, mismatches)
+				}
+			}
+			if missing := z.MissingEntries(); !reflect.DeepEqual(missing, []ManifestEntry{manifest[2]}) {
+				t.Errorf("expected d.txt missing, got %v", missing)
+			}
+		})
+	}
+
+	// in strict mode, the first mismatch is an error returned by
+	// GetNextEntry, for an entry with data descriptor once it has been read
+	fixed := append([]ManifestEntry{}, manifest...)
+	fixed[1].UncompressedSize = size(12)
+	badCRC := append([]ManifestEntry{}, fixed...)
+	badCRC[0].CRC32 = new(uint32)
+	strictTests := []struct {
+		name     string
+		manifest []ManifestEntry
+		strict   bool
+		field    string
+		calls    int    // the number of the GetNextEntry call returning the error
+		next     string // the entry returned by the following call
+	}{
+		{"crc32", badCRC, false, "crc32", 1, "b.txt"},
+		{"data descriptor", manifest, false, "uncompressed size", 3, "dir/"},
+		{"unexpected", fixed, true, "unexpected", 4, "a.txt"},
+		{"duplicate", fixed, false, "duplicate", 5, "sub/e.txt"},
+	}
+	for _, test := range strictTests {
+		t.Run("strict "+test.name, func(t *testing.T) {
+			z := NewReader(bytes.NewReader(zipFile), WithManifest(test.manifest, test.strict))
+			z.SetStrict(true)
+			for calls := 1; ; calls++ {
+				_, err := z.GetNextEntry()
+				if err == nil {
+					continue
+				}
+				var mErr *ManifestError
+				if !errors.As(err, &mErr) {
+					t.Fatalf("expected a *ManifestError, got: %v", err)
+				}
+				if mErr.Field != test.field || calls != test.calls {
+					t.Fatalf("expected %s by call %d, got %v by call %d", test.field, test.calls, err, calls)
+				}
+				break
+			}
+			// the data of the rejected entry is skipped, a.txt following
+			// c.txt is itself rejected as a duplicate
+			_, err := z.GetNextEntry()
+			var mErr *ManifestError
+			if (err != nil && !errors.As(err, &mErr)) || z.CurrentEntry().Name != test.next {
+				t.Fatalf("expected %s to follow, got %q, %v", test.next, z.CurrentEntry().Name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package zipstream
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Default modes of the entries recording none, as archive/zip reports for
+// the entries written on MS-DOS and Windows.
+const (
+	DefaultFileMode os.FileMode = 0666
+	DefaultDirMode  os.FileMode = 0777 | os.ModeDir
+)
+
+// Mode returns the permission and mode bits of the entry, taken from the first
+// of these that records them:
+//
+//   - the ASi Unix extra field (0x756e) of the local file header,
+//   - the external attributes of the central directory record, only read
+//     with WithCentralDirectory, if the creator system is known,
+//   - DefaultDirMode for directories and DefaultFileMode for files.
+//
+// The Unix (0x000d) and Info-ZIP Unix type 2 (0x7855) extra fields record the
+// owner but no mode. A name ending with a slash always has os.ModeDir set, as
+// IsDir reports. The mode is the one recorded, applying the umask when
+// creating files is left to the caller.
+func (e *Entry) Mode() os.FileMode {
+	var mode os.FileMode
+	if e.hasAsiMode {
+		mode = unixModeToFileMode(e.asiMode)
+	} else if e.hasDirAttrs {
+		mode = e.externalMode()
+	}
+	if mode == 0 {
+		if e.IsDir() {
+			return DefaultDirMode
+		}
+		return DefaultFileMode
+	}
+	if e.IsDir() {
+		mode |= os.ModeDir
+	}
+	return mode
+}
+
+// externalMode returns the mode recorded in the external attributes, as Unix
+// mode bits or as MS-DOS attributes depending on the creator system, or zero if
+// the creator system is unknown.
+func (e *Entry) externalMode() os.FileMode {
+	switch e.CreatorVersion >> 8 {
+	case creatorUnix, creatorMacOSX:
+		return unixModeToFileMode(e.ExternalAttrs >> 16)
+	case creatorFAT, creatorNTFS, creatorVFAT:
+		if e.ExternalAttrs&msdosDir != 0 || e.IsDir() {
+			return DefaultDirMode
+		}
+		if e.ExternalAttrs&msdosReadOnly != 0 {
+			return 0444
+		}
+		return DefaultFileMode
+	}
+	return 0
+}
+
+// FileInfo returns an os.FileInfo of the entry reporting the mode returned by
+// Mode.
+func (e *Entry) FileInfo() os.FileInfo {
+	return entryFileInfo{e}
+}
+
+// String returns a single-line summary of the entry, as ls -l would list it:
+// the mode, the uncompressed size, the method, the modification date, the
+// name and the CRC32 when known, e.g.
+//
+//	-rw-r--r-- 1.2MiB deflate 2021-11-04 src/archive/zip/reader.go (crc 9a3b1c00)
+//
+// The size of a directory is a dash, the size of an entry with data descriptor
+// is a question mark until its data has been read.
+func (e *Entry) String() string {
+	size := "?"
+	if e.IsDir() {
+		size = "-"
+	} else if !e.hasDataDescriptor() || e.eof {
+		size = humanSize(e.UncompressedSize64)
+	}
+	modified := "-"
+	if !e.Modified.IsZero() {
+		modified = e.Modified.Format("2006-01-02")
+	}
+	s := fmt.Sprintf("%v %s %s %s %s", e.Mode(), size, strings.ToLower(MethodName(e.Method)), modified, e.Name)
+	if e.crcKnown && !e.IsDir() {
+		s += fmt.Sprintf(" (crc %08x)", e.CRC32)
+	}
+	return s
+}
+
+type entryFileInfo struct {
+	e *Entry
+}
+
+func (fi entryFileInfo) Name() string {
+	return path.Base(fi.e.Name)
+}
+
+func (fi entryFileInfo) Size() int64 {
+	if fi.e.UncompressedSize64 > 0 {
+		return int64(fi.e.UncompressedSize64)
+	}
+	return int64(fi.e.UncompressedSize)
+}
+
+func (fi entryFileInfo) Mode() os.FileMode {
+	return fi.e.Mode()
+}
+
+func (fi entryFileInfo) ModTime() time.Time {
+	return fi.e.Modified
+}
+
+func (fi entryFileInfo) IsDir() bool {
+	return fi.Mode().IsDir()
+}
+
+func (fi entryFileInfo) Sys() interface{} {
+	return fi.e
+}
+
+// The creator systems of the version made by field.
+const (
+	creatorFAT    = 0
+	creatorUnix   = 3
+	creatorNTFS   = 11
+	creatorVFAT   = 14
+	creatorMacOSX = 19
+)
+
+// The MS-DOS attributes and Unix mode bits of the external attributes.
+const (
+	msdosDir      = 0x10
+	msdosReadOnly = 0x01
+
+	s_IFMT   = 0xf000
+	s_IFSOCK = 0xc000
+	s_IFLNK  = 0xa000
+	s_IFREG  = 0x8000
+	s_IFBLK  = 0x6000
+	s_IFDIR  = 0x4000
+	s_IFCHR  = 0x2000
+	s_IFIFO  = 0x1000
+	s_ISUID  = 0x800
+	s_ISGID  = 0x400
+	s_ISVTX  = 0x200
+)
+
+// unixModeToFileMode converts a Unix st_mode, as archive/zip does.
+func unixModeToFileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & s_IFMT {
+	case s_IFBLK:
+		mode |= os.ModeDevice
+	case s_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case s_IFDIR:
+		mode |= os.ModeDir
+	case s_IFIFO:
+		mode |= os.ModeNamedPipe
+	case s_IFLNK:
+		mode |= os.ModeSymlink
+	case s_IFREG:
+		// nothing to do
+	case s_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if m&s_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&s_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&s_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
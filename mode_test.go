@@ -0,0 +1,187 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// asiExtra returns an ASi Unix extra field recording mode.
+func asiExtra(mode uint32) []byte {
+	extra := make([]byte, 4+14)
+	binary.LittleEndian.PutUint16(extra, AsiUnixExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 14)
+	binary.LittleEndian.PutUint16(extra[8:], uint16(mode))
+	return extra
+}
+
+func TestEntryMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  zip.FileHeader
+		mode    os.FileMode // expected without the central directory
+		dirMode os.FileMode // expected with the central directory
+	}{
+		{
+			name:    "no metadata file",
+			header:  zip.FileHeader{Name: "a.txt", CreatorVersion: 20},
+			mode:    DefaultFileMode,
+			dirMode: DefaultFileMode,
+		},
+		{
+			name:    "no metadata directory",
+			header:  zip.FileHeader{Name: "dir/", CreatorVersion: 20},
+			mode:    DefaultDirMode,
+			dirMode: DefaultDirMode,
+		},
+		{
+			name:    "MS-DOS read-only",
+			header:  zip.FileHeader{Name: "ro.txt", CreatorVersion: 20, ExternalAttrs: 0x01},
+			mode:    DefaultFileMode,
+			dirMode: 0444,
+		},
+		{
+			name:    "Unix external attributes",
+			header:  zip.FileHeader{Name: "run.sh", CreatorVersion: 3<<8 | 20, ExternalAttrs: (s_IFREG | 0755) << 16},
+			mode:    DefaultFileMode,
+			dirMode: 0755,
+		},
+		{
+			name:    "Unix external attributes without slash",
+			header:  zip.FileHeader{Name: "dir", CreatorVersion: 3<<8 | 20, ExternalAttrs: (s_IFDIR | 0700) << 16},
+			mode:    DefaultFileMode,
+			dirMode: 0700 | os.ModeDir,
+		},
+		{
+			name:    "unknown creator",
+			header:  zip.FileHeader{Name: "b.txt", CreatorVersion: 30<<8 | 20, ExternalAttrs: 0xffff0000},
+			mode:    DefaultFileMode,
+			dirMode: DefaultFileMode,
+		},
+		{
+			name:    "ASi extra",
+			header:  zip.FileHeader{Name: "c.txt", CreatorVersion: 20, Extra: asiExtra(s_IFREG | 0600)},
+			mode:    0600,
+			dirMode: 0600,
+		},
+		{
+			name: "ASi extra over external attributes",
+			header: zip.FileHeader{Name: "d.txt", CreatorVersion: 3<<8 | 20, ExternalAttrs: (s_IFREG | 0644) << 16,
+				Extra: asiExtra(s_IFLNK | 0777)},
+			mode:    0777 | os.ModeSymlink,
+			dirMode: 0777 | os.ModeSymlink,
+		},
+		{
+			name:    "ASi extra file mode with slash",
+			header:  zip.FileHeader{Name: "e/", CreatorVersion: 20, Extra: asiExtra(s_IFREG | 0750)},
+			mode:    0750 | os.ModeDir,
+			dirMode: 0750 | os.ModeDir,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := test.header
+			zipFile := buildZip(t, func(zw *zip.Writer) error {
+				_, err := zw.CreateRaw(&header)
+				return err
+			})
+			for _, withDir := range []bool{false, true} {
+				var opts []Option
+				expected := test.mode
+				if withDir {
+					opts = append(opts, WithCentralDirectory())
+					expected = test.dirMode
+				}
+				z := NewReader(bytes.NewReader(zipFile), opts...)
+				entry, err := z.GetNextEntry()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := z.GetNextEntry(); err != io.EOF {
+					t.Fatalf("expected io.EOF, got: %v", err)
+				}
+				if mode := entry.Mode(); mode != expected {
+					t.Errorf("central directory %v: expected mode %v, got %v", withDir, expected, mode)
+				}
+				fi := entry.FileInfo()
+				if fi.Mode() != expected || fi.IsDir() != expected.IsDir() || fi.Sys() != entry {
+					t.Errorf("central directory %v: unexpected file info mode %v", withDir, fi.Mode())
+				}
+			}
+		})
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	modified := time.Date(2021, time.November, 4, 10, 0, 0, 0, time.UTC)
+	contents := []byte(strings.Repeat("x", 1258291))
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		headers := []*zip.FileHeader{
+			{Name: "src/reader.go", Method: zip.Deflate, Modified: modified},
+			{Name: "src/", Modified: modified},
+			{Name: "link", Modified: modified, Extra: asiExtra(s_IFLNK | 0777)},
+			{Name: "run.sh", Modified: modified, Extra: asiExtra(s_IFREG | 0755), CRC32: 0x9a3b1c00, UncompressedSize64: 3},
+		}
+		for i, fh := range headers {
+			var w io.Writer
+			var err error
+			if i == 0 {
+				w, err = zw.CreateHeader(fh)
+			} else {
+				// CreateRaw doesn't set the MS-DOS time from Modified
+				fh.ModifiedDate = (2021-1980)<<9 | 11<<5 | 4
+				fh.ModifiedTime = 10 << 11
+				fh.CompressedSize64 = fh.UncompressedSize64
+				w, err = zw.CreateRaw(fh)
+			}
+			if err != nil {
+				return err
+			}
+			switch i {
+			case 0:
+				_, err = w.Write(contents)
+			case 3:
+				_, err = w.Write([]byte("abc"))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	expected := []string{
+		"-rw-rw-rw- ? deflate 2021-11-04 src/reader.go",
+		"drwxrwxrwx - store 2021-11-04 src/",
+		"Lrwxrwxrwx 0B store 2021-11-04 link (crc 00000000)",
+		"-rwxr-xr-x 3B store 2021-11-04 run.sh (crc 9a3b1c00)",
+	}
+	for i, s := range expected {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := entry.String(); got != s {
+			t.Errorf("expected %q, got %q", s, got)
+		}
+		if i == 0 {
+			// the size and CRC32 are known once the data has been read
+			if _, err := io.Copy(io.Discard, entry); err != nil {
+				t.Fatal(err)
+			}
+			s = fmt.Sprintf("-rw-rw-rw- 1.2MiB deflate 2021-11-04 src/reader.go (crc %08x)", crc32.ChecksumIEEE(contents))
+			if got := fmt.Sprint(entry); got != s {
+				t.Errorf("expected %q, got %q", s, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package zipstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MaxReadAllSize is the total size of the entry contents Reader.ReadAll
+// reads into memory.
+var MaxReadAllSize int64 = 64 << 20
+
+// ErrArchiveTooLarge is returned by Reader.ReadAll when the entry contents
+// exceed MaxReadAllSize.
+var ErrArchiveTooLarge = errors.New("zipstream: archive is too large to be read into memory")
+
+// ReadAll reads the remaining entries into a map of name to contents, for
+// small archives. Directory entries are skipped, the contents of an entry
+// repeated under the same name replace the previous ones.
+func (z *Reader) ReadAll() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	remaining := MaxReadAllSize
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.IsDir() {
+			continue
+		}
+		if entry.UncompressedSize64 > uint64(remaining) {
+			return nil, ErrArchiveTooLarge
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		n, err := io.Copy(&buf, io.LimitReader(rc, remaining+1))
+		if err != nil {
+			return nil, err
+		}
+		if n > remaining {
+			return nil, ErrArchiveTooLarge
+		}
+		if err := rc.Close(); err != nil {
+			return nil, err
+		}
+		remaining -= n
+		files[entry.Name] = buf.Bytes()
+	}
+}
+
+// ConcatReader returns a reader of the contents of the remaining entries
+// concatenated, directory entries are skipped. The Reader advances as the
+// returned reader is read, an error reading an entry ends it.
+func (z *Reader) ConcatReader() io.Reader {
+	return &concatReader{z: z}
+}
+
+type concatReader struct {
+	z   *Reader
+	rc  io.ReadCloser // contents of the current entry, nil between entries
+	err error         // sticky error
+}
+
+func (r *concatReader) Read(b []byte) (int, error) {
+	for r.err == nil {
+		if r.rc == nil {
+			entry, err := r.z.GetNextEntry()
+			if err != nil {
+				r.err = err
+				break
+			}
+			if entry.IsDir() {
+				continue
+			}
+			if r.rc, err = entry.Open(); err != nil {
+				r.err = err
+				break
+			}
+		}
+		n, err := r.rc.Read(b)
+		if err == io.EOF {
+			err = r.rc.Close()
+			r.rc = nil
+		}
+		if err != nil {
+			r.err = err
+		}
+		if n > 0 || len(b) == 0 {
+			return n, nil
+		}
+	}
+	return 0, r.err
+}
@@ -0,0 +1,92 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestReadAll(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := NewReader(bytes.NewReader(zipFile)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	n := 0
+	for _, zf := range az.File {
+		if zf.Mode().IsDir() {
+			continue
+		}
+		n++
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += int64(len(expected))
+		if content, ok := files[zf.Name]; !ok || !bytes.Equal(content, expected) {
+			t.Fatalf("the contents of %s are incorrect", zf.Name)
+		}
+	}
+	if len(files) != n {
+		t.Fatalf("expected %d files, got %d", n, len(files))
+	}
+
+	defer func(size int64) { MaxReadAllSize = size }(MaxReadAllSize)
+	MaxReadAllSize = total - 1
+	if _, err := NewReader(bytes.NewReader(zipFile)).ReadAll(); err != ErrArchiveTooLarge {
+		t.Fatalf("expected ErrArchiveTooLarge, got: %v", err)
+	}
+}
+
+func TestConcatReader(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	for _, zf := range az.File {
+		if zf.Mode().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(&expected, rc); err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, NewReader(bytes.NewReader(zipFile)).ConcatReader()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Fatalf("expected %d bytes of contents, got %d", expected.Len(), buf.Len())
+	}
+
+	// an error ends the reader
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(zipFile[:len(zipFile)/2])).ConcatReader()); err == nil || err == io.EOF {
+		t.Fatalf("expected an error for a truncated archive, got: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package zipstream
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"compress/flate"
 	"encoding/binary"
@@ -10,43 +11,343 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
-	headerIdentifierLen      = 4
-	fileHeaderLen            = 26
-	dataDescriptorLen        = 16 // four uint32: descriptor signature, crc32, compressed size, size
-	fileHeaderSignature      = 0x04034b50
-	directoryHeaderSignature = 0x02014b50
-	directoryEndSignature    = 0x06054b50
-	dataDescriptorSignature  = 0x08074b50
+	headerIdentifierLen       = 4
+	fileHeaderLen             = 26
+	dataDescriptorLen         = 16 // four uint32: descriptor signature, crc32, compressed size, size
+	dataDescriptor64Len       = 24 // two uint32: signature, crc32 | two uint64: compressed size, size
+	fileHeaderSignature       = 0x04034b50
+	directoryHeaderSignature  = 0x02014b50
+	directoryEndSignature     = 0x06054b50
+	dataDescriptorSignature   = 0x08074b50
+	archiveExtraDataSignature = 0x08064b50 // precedes an encrypted central directory
+	spanningMarkerSignature   = 0x30304b50 // "PK00", written by PKZIP at the start of spanned archives
 
 	// Extra header IDs.
 	// See http://mdfs.net/Docs/Comp/Archiving/Zip/ExtraField
 
-	Zip64ExtraID       = 0x0001 // Zip64 extended information
-	NtfsExtraID        = 0x000a // NTFS
-	UnixExtraID        = 0x000d // UNIX
-	ExtTimeExtraID     = 0x5455 // Extended timestamp
-	InfoZipUnixExtraID = 0x5855 // Info-ZIP Unix extension
+	Zip64ExtraID        = 0x0001 // Zip64 extended information
+	NtfsExtraID         = 0x000a // NTFS
+	UnixExtraID         = 0x000d // UNIX
+	ExtTimeExtraID      = 0x5455 // Extended timestamp
+	InfoZipUnixExtraID  = 0x5855 // Info-ZIP Unix extension
+	InfoZipUnix2ExtraID = 0x7855 // Info-ZIP Unix extension type 2, uid and gid
+	AsiUnixExtraID      = 0x756e // ASi Unix, mode, uid and gid
+	JarMarkerExtraID    = 0xcafe // Java JAR marker, written to the first entry of a JAR
+	ZipAlignExtraID     = 0xd935 // Android zipalign padding
+	paddingExtraID      = 0x0000 // zero padding
+)
 
+const (
+	// The APK Signing Block sits between the last entry and the central
+	// directory of signed APKs, it starts and ends with its size (uint64)
+	// and ends with signingBlockMagic.
+	// See https://source.android.com/docs/security/features/apksigning/v2
+	signingBlockMagic   = "APK Sig Block 42"
+	maxSigningBlockSize = 16 << 20
+	minSigningBlockSize = 8 + len(signingBlockMagic) // trailing size and magic
 )
 
 const (
-	CompressMethodStored   = 0
-	CompressMethodDeflated = 8
+	CompressMethodStored    = 0
+	CompressMethodDeflated  = 8
+	CompressMethodDeflate64 = 9
 )
 
+// MethodName returns the name of a compression method, or "method N" if it
+// isn't a well-known one.
+func MethodName(method uint16) string {
+	switch method {
+	case CompressMethodStored:
+		return "Store"
+	case CompressMethodDeflated:
+		return "Deflate"
+	case CompressMethodDeflate64:
+		return "Deflate64"
+	case 12:
+		return "BZIP2"
+	case 14:
+		return "LZMA"
+	case 93:
+		return "Zstandard"
+	case 95:
+		return "XZ"
+	case 98:
+		return "PPMd"
+	case 99:
+		return "AES"
+	}
+	return fmt.Sprintf("method %d", method)
+}
+
+var (
+	// ErrCentralDirEncrypted is returned when the archive uses WinZip/PKWARE
+	// central directory encryption, the local headers are masked and the
+	// central directory can't be read without decrypting it.
+	ErrCentralDirEncrypted = errors.New("zipstream: central directory is encrypted")
+
+	// ErrPrefixTooLong is returned when no local file header is found within
+	// the number of bytes allowed by WithHeaderScan.
+	ErrPrefixTooLong = errors.New("zipstream: no local file header found within the allowed prefix")
+
+	// ErrEntryTooLarge is returned by Entry.Bytes and Entry.OpenString when
+	// the entry contents exceed MaxBytesSize.
+	ErrEntryTooLarge = errors.New("zipstream: entry is too large to be read into memory")
+
+	// ErrSizeTooLargeForPlatform is returned by Entry.Bytes and
+	// Entry.OpenString when the entry size exceeds the largest int.
+	ErrSizeTooLargeForPlatform = errors.New("zipstream: entry size exceeds the maximum int of this platform")
+
+	// ErrEmptyStream is returned when the stream ends before any byte is read.
+	ErrEmptyStream = errors.New("zipstream: empty stream")
+
+	// ErrTruncated is returned when the stream ends in the middle of a zip
+	// structure, e.g. the archive download was cut off. The returned errors
+	// are *TruncatedError values, use errors.Is to check for it.
+	ErrTruncated = errors.New("zipstream: archive is truncated")
+
+	// ErrIncompleteArchive is returned at the end of the archive when fewer
+	// entries were read than set by Reader.ExpectEntries.
+	ErrIncompleteArchive = errors.New("zipstream: archive has fewer entries than expected")
+
+	// ErrUnknownSize is returned when an operation needs the compressed size
+	// of an entry whose sizes are only recorded in its data descriptor.
+	ErrUnknownSize = errors.New("zipstream: entry size is unknown until its data descriptor is read")
+
+	// ErrCannotSkip is returned when an entry with data descriptor uses a
+	// compression method without registered decompressor, its end can only
+	// be found by decompressing it, so the following entries are unreachable.
+	ErrCannotSkip = errors.New("zipstream: cannot skip an entry with data descriptor and unsupported compression method")
+
+	// ErrEntryNotConsumed is returned by GetNextEntry with WithManualSkip
+	// when the data of the current entry has not been read to its end.
+	ErrEntryNotConsumed = errors.New("zipstream: the data of the previous entry was not consumed")
+
+	// ErrEntryInUse is returned by GetNextEntry when the data of the current
+	// entry is being read by another goroutine, skipping it would interleave
+	// the reads of the stream.
+	ErrEntryInUse = errors.New("zipstream: the data of the previous entry is being read")
+
+	// ErrNotZip is returned by GetNextEntry with Reader.SetExpectSignature
+	// when the stream doesn't start with a local file header.
+	ErrNotZip = errors.New("zipstream: the stream doesn't start with a local file header")
+)
+
+// TruncatedError records where a truncated archive ends.
+type TruncatedError struct {
+	Offset    int64  // stream offset at which the data ended
+	Structure string // the structure being read, e.g. "local file header"
+	Name      string // name of the entry whose data is truncated, if known
+	Missing   int64  // number of bytes missing, if known
+}
+
+func (e *TruncatedError) Error() string {
+	msg := fmt.Sprintf("zipstream: archive is truncated at offset %d while reading %s", e.Offset, e.Structure)
+	if e.Name != "" {
+		msg += fmt.Sprintf(" of entry %q", e.Name)
+	}
+	if e.Missing > 0 {
+		msg += fmt.Sprintf(", %d bytes missing", e.Missing)
+	}
+	return msg
+}
+
+func (e *TruncatedError) Is(target error) bool {
+	return target == ErrTruncated
+}
+
+// FormatError describes a malformed structure of an entry, it matches
+// zip.ErrFormat with errors.Is.
+type FormatError struct {
+	Name   string // name of the entry
+	Offset int64  // stream offset of the malformed structure
+	Msg    string
+	Err    error // underlying error, if any, e.g. a flate.CorruptInputError
+}
+
+func (e *FormatError) Error() string {
+	msg := fmt.Sprintf("zipstream: %s of entry %q at offset %d", e.Msg, e.Name, e.Offset)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FormatError) Is(target error) bool {
+	return target == zip.ErrFormat
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedMethodError is returned when an entry is opened whose compression
+// method has no registered decompressor, it matches zip.ErrAlgorithm with
+// errors.Is.
+type UnsupportedMethodError struct {
+	Name   string // name of the entry
+	Method uint16
+}
+
+func (e *UnsupportedMethodError) Error() string {
+	desc := ""
+	if e.Method == CompressMethodDeflate64 {
+		desc = " (Deflate64)"
+	}
+	return fmt.Sprintf("zipstream: unsupported compression method %d%s of entry %q", e.Method, desc, e.Name)
+}
+
+func (e *UnsupportedMethodError) Is(target error) bool {
+	return target == zip.ErrAlgorithm
+}
+
+// EntryError locates an error reading an entry: the entry, its zero-based
+// index in the stream and the stream offset at which the error was detected.
+// It wraps the errors of GetNextEntry reading a local file header and the
+// errors of the readers returned by Open and OpenRaw.
+type EntryError struct {
+	Index  int    // zero-based index of the entry
+	Name   string // name of the entry, empty if not read yet
+	Offset int64  // stream offset at which the error was detected
+	Err    error
+}
+
+func (e *EntryError) Error() string {
+	name := ""
+	if e.Name != "" {
+		name = fmt.Sprintf(" %q", e.Name)
+	}
+	return fmt.Sprintf("zipstream: entry %d%s at offset %d: %v", e.Index, name, e.Offset, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// HeaderError describes an invalid or contradictory field of a local file
+// header, it matches zip.ErrFormat with errors.Is.
+type HeaderError struct {
+	Index  int    // zero-based index of the entry
+	Offset int64  // stream offset of the local file header
+	Name   string // name of the entry, empty if not read yet
+	Field  string // name of the invalid field
+	Value  uint64 // value of the invalid field
+	Err    error  // underlying error, if any
+}
+
+func (e *HeaderError) Error() string {
+	msg := fmt.Sprintf("zipstream: invalid %s %d in local file header of entry %d %q at offset %d", e.Field, e.Value, e.Index, e.Name, e.Offset)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HeaderError) Is(target error) bool {
+	return target == zip.ErrFormat
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// The structures reported by TruncatedError.
+const (
+	structSignature    = "header signature"
+	structFileHeader   = "local file header"
+	structNameExtra    = "file name and extra field"
+	structEntryData    = "entry data"
+	structDescriptor   = "data descriptor"
+	structCentralDir   = "central directory"
+	structSigningBlock = "APK Signing Block"
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+// bytesPrealloc is the largest buffer allocated by Entry.Bytes before reading.
+const bytesPrealloc = 64 << 10
+
+// maxReaderVersion is the highest version needed to extract accepted in a
+// local file header in strict mode, version 6.3 of the specification.
+const maxReaderVersion = 63
+
+// MaxEntrySignatureScan limits the bytes skipped after an entry to find the
+// next signature with Reader.SetEntrySignatureScan.
+var MaxEntrySignatureScan = 64 << 10
+
+// MaxBytesSize limits the size of the entry contents read into memory by
+// Entry.Bytes and Entry.OpenString.
+var MaxBytesSize int64 = 1 << 30
+
 type Entry struct {
 	zip.FileHeader
-	r                          io.Reader
-	lr                         io.Reader // LimitReader
-	zip64                      bool
-	hasReadNum                 uint64
-	hasDataDescriptorSignature bool
-	eof                        bool
+
+	// The sizes and the CRC32 observed while reading the entry data, set
+	// once it has been read to its end or has failed. The observed
+	// compressed size is the number of bytes the decompressor consumed,
+	// OpenRaw observes no CRC32.
+	ObservedCompressedSize   uint64
+	ObservedUncompressedSize uint64
+	ObservedCRC32            uint32
+
+	ArchiveIndex int // zero-based index of the archive, see WithConcatenatedArchives
+
+	// Insecure is set if the name is not a local path: it is absolute,
+	// rooted, has a drive letter, escapes with ".." elements or contains
+	// a NUL byte. Such entries must not be extracted as named.
+	Insecure bool
+
+	// ReservedName is set if an element of the name is a Windows reserved
+	// device name, such as CON or com1.log, which can't be extracted as
+	// named on Windows.
+	ReservedName bool
+
+	z        *Reader
+	r        *bufio.Reader
+	lr       io.Reader // LimitReader, or a countReader if the sizes are in the data descriptor
+	zip64    bool
+	crcKnown bool      // CRC32 holds an authoritative value, either from the local header or the data descriptor
+	rc       io.Reader // the reader returned by Open or OpenRaw
+	openErr  error     // the error of the Open done by Read
+	reading  int32     // number of reads of the entry data in progress, updated atomically
+	notified bool      // the descriptor callback has been invoked
+	computed bool      // ObservedCRC32 covers the whole decompressed data
+	checksum uint32    // sum of the hash set by Reader.SetChecksumHash
+	summed   bool      // checksum covers the whole decompressed data
+	eof      bool
+
+	digests map[string][]byte // see WithHashers
+	section *sectionReader    // the reader returned by OpenRaw reading the source directly, see sourceSection
+
+	manifest    *ManifestEntry // manifest entry whose size and CRC32 are checked once the data has been read
+	reported    bool           // the entry was reported to the stats collector
+	skippedData bool           // the rest of the data was discarded by skip
+
+	index        int   // zero-based index of the entry in the stream
+	headerOffset int64 // stream offset of the local file header
+	dataOffset   int64 // stream offset of the entry data
+	uid, gid     int
+	hasOwner     bool
+	asiMode      uint32 // Unix mode of the ASi Unix extra field
+	hasAsiMode   bool
+	hasDirAttrs  bool // ExternalAttrs were completed from the central directory
+
+	ntfsModified, ntfsAccessed, ntfsCreated time.Time
+	warnings                                []ParseWarning
+	unsupportedExtras                       []uint16
+
+	descriptorCRC uint32
+	skipped       int64 // bytes discarded by GetNextEntry
+	corrupt       bool  // CRC32 mismatch tolerated by OpenAllowCorrupt
+	report        StreamabilityReport
 }
 
 func (e *Entry) hasDataDescriptor() bool {
@@ -58,40 +359,889 @@ func (e *Entry) IsDir() bool {
 	return len(e.Name) > 0 && e.Name[len(e.Name)-1] == '/'
 }
 
+// IsDeflate64 reports whether the entry is compressed with Deflate64
+// (enhanced deflate), which is not decoded by this package. It is method 9,
+// or method 8 with the enhanced deflating flag (bit 4) set by a producer
+// requiring at least version 2.1.
+func (e *Entry) IsDeflate64() bool {
+	if e.Method == CompressMethodDeflate64 {
+		return true
+	}
+	return e.Method == CompressMethodDeflated && e.Flags&0x10 != 0 && e.ReaderVersion&0xff >= 21
+}
+
+// CanDecode reports whether a decompressor is registered for the compression
+// method of the entry, so that it can be opened.
+func (e *Entry) CanDecode() bool {
+	return e.z.SupportsMethod(e.Method)
+}
+
+// Owner returns the uid and gid recorded in the Info-ZIP Unix type 2 extra
+// field, ok is false if the entry has none.
+func (e *Entry) Owner() (uid, gid int, ok bool) {
+	return e.uid, e.gid, e.hasOwner
+}
+
+// NTFSTimes returns the modification, access and creation times recorded in
+// the NTFS extra field, as written by Windows Explorer, ok is false if the
+// entry has none.
+func (e *Entry) NTFSTimes() (modified, accessed, created time.Time, ok bool) {
+	return e.ntfsModified, e.ntfsAccessed, e.ntfsCreated, !e.ntfsModified.IsZero()
+}
+
+// DOSAttributes decodes the MS-DOS attributes in the low byte of
+// ExternalAttrs, which is only recorded in the central directory, see
+// WithCentralDirectory.
+func (e *Entry) DOSAttributes() (readonly, hidden, system, archive bool) {
+	attrs := e.ExternalAttrs & 0xff
+	return attrs&0x01 != 0, attrs&0x02 != 0, attrs&0x04 != 0, attrs&0x20 != 0
+}
+
+// UnsupportedExtras returns the IDs of the extra fields of the local file
+// header which are defined by the PKWARE specification but not interpreted by
+// this package, such as the Patch Descriptor (0x000f) or the Record Management
+// Controls (0x0018). They are only recorded in strict mode, see SetStrict.
+func (e *Entry) UnsupportedExtras() []uint16 {
+	return e.unsupportedExtras
+}
+
+// isPKWareExtra reports whether id is an extra field ID defined by the PKWARE
+// specification, section 4.5.2, and not interpreted by this package.
+func isPKWareExtra(id uint16) bool {
+	switch id {
+	case 0x0007, // AV Info
+		0x0008, // Reserved for extended language encoding data (PFS)
+		0x0009, // OS/2
+		0x000c, // OpenVMS
+		0x000e, // Reserved for file stream and fork descriptors
+		0x000f, // Patch Descriptor
+		0x0014, // PKCS#7 Store for X.509 Certificates
+		0x0015, // X.509 Certificate ID and Signature for individual file
+		0x0016, // X.509 Certificate ID for Central Directory
+		0x0017, // Strong Encryption Header
+		0x0018, // Record Management Controls
+		0x0019, // PKCS#7 Encryption Recipient Certificate List
+		0x0020, // Reserved for Timestamp record
+		0x0021, // Policy Decryption Key Record
+		0x0022, // Smartcrypt Key Provider Record
+		0x0023, // Smartcrypt Policy Key Data Record
+		0x0065, // IBM S/390 (Z390), AS/400 (I400) attributes - uncompressed
+		0x0066, // Reserved for IBM S/390 (Z390), AS/400 (I400) attributes - compressed
+		0x4690: // POSZIP 4690 (reserved)
+		return true
+	}
+	return false
+}
+
+// DescriptorCRC returns the CRC32 recorded in the data descriptor, it is zero
+// until the data descriptor has been read or if the entry has none.
+func (e *Entry) DescriptorCRC() uint32 {
+	return e.descriptorCRC
+}
+
+// Open returns a reader of the decompressed entry data, the sizes and the
+// CRC32 are verified once its end is reached. When a Read fails, e.g. on a
+// size or CRC32 mismatch or on corrupt compressed data, the stream is already
+// positioned at the next record so that GetNextEntry can carry on. The errors
+// fatal to the stream are the truncation of the archive and the corruption of
+// the data of an entry with data descriptor, whose end can't be found then.
 func (e *Entry) Open() (io.ReadCloser, error) {
+	return e.open(e.z.decompressor(e.Method), false)
+}
+
+// OpenMulti is like Open, but the decompressed data is also written to all of
+// ws as it is read, e.g. to write it to a file and to a hash at once. A write
+// error is returned by Read. The CRC32 is verified as with Open.
+func (e *Entry) OpenMulti(ws ...io.Writer) (io.ReadCloser, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(rc, io.MultiWriter(ws...)), rc}, nil
+}
+
+// OpenAllowCorrupt is like Open, but a CRC32 mismatch of the decompressed data
+// doesn't fail the reader: all the data is returned and Corrupt reports the
+// mismatch once the reader reached io.EOF, so that the data can be salvaged.
+func (e *Entry) OpenAllowCorrupt() (io.ReadCloser, error) {
+	return e.open(e.z.decompressor(e.Method), true)
+}
+
+// ComputedCRC32 returns the CRC32 of the decompressed data once it has been
+// read to its end with Open or a variant, or by Skip or GetNextEntry
+// decompressing an entry with data descriptor to find its end. ok is false if
+// the data was not decompressed to its end, e.g. after OpenRaw or the skip of
+// a sized entry.
+func (e *Entry) ComputedCRC32() (crc uint32, ok bool) {
+	if !e.computed {
+		return 0, false
+	}
+	return e.ObservedCRC32, true
+}
+
+// ReportedCRC32 returns the CRC32 the archive records for the entry, taken
+// from the data descriptor once it has been read for an entry with data
+// descriptor, from the local header otherwise. ok is false until the data
+// descriptor has been read. Comparing it with ComputedCRC32 detects the
+// producers writing wrong descriptors.
+func (e *Entry) ReportedCRC32() (crc uint32, ok bool) {
+	if !e.crcKnown {
+		return 0, false
+	}
+	return e.CRC32, true
+}
+
+// ChecksumSum returns the sum of the hash set by Reader.SetChecksumHash, CRC32
+// by default, of the decompressed data once it has been read to its end, zero
+// until then. It is not compared to any value recorded in the archive.
+func (e *Entry) ChecksumSum() uint32 {
+	if !e.summed {
+		return 0
+	}
+	return e.checksum
+}
+
+// Digest returns the digest of the decompressed data computed by the hash
+// registered under name with WithHashers, once the data has been read to its
+// end with Open or a variant.
+func (e *Entry) Digest(name string) ([]byte, bool) {
+	d, ok := e.digests[name]
+	return d, ok
+}
+
+// Corrupt reports whether the CRC32 of the data read with OpenAllowCorrupt
+// differs from the recorded one.
+func (e *Entry) Corrupt() bool {
+	return e.corrupt
+}
+
+// OpenWithDict is like Open for a Deflate entry whose data was compressed
+// with the preset dictionary dict, see flate.NewReaderDict.
+func (e *Entry) OpenWithDict(dict []byte) (io.ReadCloser, error) {
+	if e.Method != zip.Deflate {
+		return nil, fmt.Errorf("zipstream: a preset dictionary applies to Deflate entries, entry %q uses %s", e.Name, MethodName(e.Method))
+	}
+	return e.open(func(r io.Reader) io.ReadCloser {
+		return newFlateReaderDict(r, dict)
+	}, false)
+}
+
+func (e *Entry) open(decomp zip.Decompressor, allowCorrupt bool) (io.ReadCloser, error) {
 	if e.eof {
 		return nil, errors.New("this file has read to end")
 	}
-	decomp := decompressor(e.Method)
+	if e.rc != nil {
+		return nil, errors.New("repeated Open is not supported")
+	}
 	if decomp == nil {
-		return nil, zip.ErrAlgorithm
+		return nil, &UnsupportedMethodError{Name: e.Name, Method: e.Method}
+	}
+	r := e.lr
+	if lr, ok := e.lr.(*io.LimitedReader); ok {
+		// keep the decompressor from reading ahead of its data, so
+		// that any padding after it is left in lr
+		r = &limitedByteReader{LimitedReader: lr, r: e.r}
+	}
+	rc := &checksumReader{
+		rc:           decomp(r),
+		hash:         crc32.NewIEEE(),
+		isCRC32:      e.z.newChecksum == nil,
+		entry:        e,
+		allowCorrupt: allowCorrupt,
+	}
+	if !rc.isCRC32 {
+		rc.hash = e.z.newChecksum()
+	}
+	e.z.decompressorOpened(rc.rc)
+	if len(e.z.hashers) > 0 {
+		rc.hashers = make(map[string]hash.Hash, len(e.z.hashers))
+		for name, newHash := range e.z.hashers {
+			rc.hashers[name] = newHash()
+		}
 	}
-	rc := decomp(e.lr)
+	e.rc = rc
+	return rc, nil
+}
 
-	return &checksumReader{
-		rc:    rc,
-		hash:  crc32.NewIEEE(),
-		entry: e,
-	}, nil
+// OpenRaw returns a reader of the entry data without decompressing it.
+// The CRC32 is not verified, but the sizes recorded in the data descriptor
+// are, for which an entry with data descriptor still has to be decompressed
+// to find the end of its data. The decompression runs in the calling goroutine,
+// interleaved with the reads, and only buffers the compressed bytes the
+// decompressor consumed and not yet handed out.
+//
+// The reader of a STORED entry without data descriptor is also an io.ReaderAt
+// and an io.Seeker, a section of the source, when the source is an
+// io.ReaderAt and an io.Seeker, such as an *os.File, whose size covers the
+// entry data and which isn't hashed. It reads the data directly from the
+// source, and the Reader seeks past the data instead of reading it again.
+func (e *Entry) OpenRaw() (io.Reader, error) {
+	if e.eof {
+		return nil, errors.New("this file has read to end")
+	}
+	if e.rc != nil {
+		return nil, errors.New("repeated Open is not supported")
+	}
+	if section := e.sourceSection(); section != nil {
+		e.section = &sectionReader{SectionReader: section, entry: e}
+		e.rc = e.section
+		return e.section, nil
+	}
+	rr := &rawReader{entry: e}
+	if e.hasDataDescriptor() {
+		decomp := e.z.decompressor(e.Method)
+		if decomp == nil {
+			return nil, &UnsupportedMethodError{Name: e.Name, Method: e.Method}
+		}
+		rr.tee = &teeReader{r: e.lr.(*countReader)}
+		rr.fr = decomp(rr.tee)
+		e.z.decompressorOpened(rr.fr)
+		rr.scratch = make([]byte, e.z.rawBufSize)
+	}
+	e.rc = rr
+	return rr, nil
+}
+
+// CopyRawN copies up to n bytes of the compressed entry data to w without
+// decompressing it, successive calls continue where the previous one stopped.
+// It returns ErrUnknownSize for entries with data descriptor.
+func (e *Entry) CopyRawN(w io.Writer, n int64) (int64, error) {
+	if e.hasDataDescriptor() {
+		return 0, ErrUnknownSize
+	}
+	if e.rc == nil {
+		if _, err := e.OpenRaw(); err != nil {
+			return 0, err
+		}
+	}
+	if _, ok := e.rc.(*rawReader); !ok && e.section == nil {
+		return 0, errors.New("repeated Open is not supported")
+	}
+	written, err := io.CopyN(w, e.rc, n)
+	if err == io.EOF {
+		err = nil
+	}
+	return written, err
+}
+
+// Read reads the decompressed data of the entry, so that an Entry can be used
+// as an io.ReadCloser. The entry is opened by the first Read, an error opening
+// it is returned by all the calls. Once the entry has been opened with Open
+// or OpenRaw, Read reads from the reader they returned. Read returns io.EOF
+// once the data has been consumed, including by Skip.
+func (e *Entry) Read(p []byte) (int, error) {
+	if e.openErr != nil {
+		return 0, e.openErr
+	}
+	if e.rc == nil {
+		if e.eof {
+			return 0, io.EOF
+		}
+		if _, err := e.Open(); err != nil {
+			e.openErr = err
+			return 0, err
+		}
+	}
+	return e.rc.Read(p)
+}
+
+// Close closes the reader opened by Read or Open, it does nothing if the entry
+// has not been opened.
+func (e *Entry) Close() error {
+	if c, ok := e.rc.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Reader returns the reader of the decompressed entry data, opening the entry
+// with Open on the first call. The following calls, and the calls after Open
+// or Read opened the entry, return the same reader instance rather than
+// failing as a repeated Open does. An entry opened with OpenRaw has no such
+// reader.
+func (e *Entry) Reader() (io.ReadCloser, error) {
+	if e.rc == nil {
+		return e.Open()
+	}
+	rc, ok := e.rc.(*checksumReader)
+	if !ok {
+		return nil, errors.New("the entry was opened with OpenRaw")
+	}
+	return rc, nil
+}
+
+// Bytes opens the entry and reads its whole contents into memory.
+func (e *Entry) Bytes() ([]byte, error) {
+	if e.UncompressedSize64 > uint64(maxInt) {
+		return nil, ErrSizeTooLargeForPlatform
+	}
+	if e.UncompressedSize64 > uint64(MaxBytesSize) {
+		return nil, ErrEntryTooLarge
+	}
+	rc, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	limit := MaxBytesSize
+	if int64(maxInt) < limit {
+		limit = int64(maxInt)
+	}
+	// the declared size is untrusted, the buffer grows past bytesPrealloc
+	// only as the data is read
+	prealloc := e.UncompressedSize64
+	if prealloc > bytesPrealloc {
+		prealloc = bytesPrealloc
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, int(prealloc)))
+	n, err := io.Copy(buf, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		if limit < MaxBytesSize {
+			return nil, ErrSizeTooLargeForPlatform
+		}
+		return nil, ErrEntryTooLarge
+	}
+	return buf.Bytes(), rc.Close()
+}
+
+// OpenString opens the entry and returns its whole contents as a string,
+// it is meant for small text files such as manifests.
+func (e *Entry) OpenString() (string, error) {
+	b, err := e.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Skip discards the unread data of the entry, including its data descriptor,
+// so that the next entry can be read. It is done by GetNextEntry unless
+// WithManualSkip is set.
+func (e *Entry) Skip() error {
+	if e.eof {
+		return nil
+	}
+	return e.skip()
+}
+
+// SkippedBytes returns the number of bytes of the stream GetNextEntry
+// discarded to skip the unread data of the entry, zero if it was read to its
+// end.
+func (e *Entry) SkippedBytes() int64 {
+	return e.skipped
+}
+
+// Consumed reports whether the entry data has been read to its end, or
+// skipped, or is known to be empty.
+func (e *Entry) Consumed() bool {
+	return e.consumed()
+}
+
+// Opened reports whether the entry has been opened, with Open, OpenRaw or
+// a variant, or by Read.
+func (e *Entry) Opened() bool {
+	return e.rc != nil
+}
+
+// consumed reports whether the entry data has been read to its end, or is
+// known to be empty.
+func (e *Entry) consumed() bool {
+	if e.eof {
+		return true
+	}
+	lr, sized := e.lr.(*io.LimitedReader)
+	return sized && lr.N == 0
+}
+
+// skip discards the rest of the entry data, including its data descriptor.
+// Entries whose sizes are only recorded in the data descriptor have to be
+// decompressed to find out where they end.
+func (e *Entry) skip() error {
+	e.skippedData = true
+	if e.section != nil {
+		err := e.z.seekForward(e.lr.(*io.LimitedReader))
+		e.eof = true
+		if err == nil {
+			e.sizesKnown()
+		}
+		return err
+	}
+	if !e.hasDataDescriptor() {
+		_, err := io.Copy(io.Discard, e.lr)
+		e.eof = true
+		if err == nil {
+			e.sizesKnown()
+		}
+		// the decompressor of an entry opened and partly read is no
+		// longer needed
+		if cr, ok := e.rc.(*checksumReader); ok {
+			if cr.err == nil {
+				cr.err = errors.New("zipstream: read after the entry was skipped")
+			}
+			if err1 := cr.release(); err == nil {
+				err = err1
+			}
+		}
+		return err
+	}
+	r := e.rc
+	if r == nil {
+		if !e.CanDecode() {
+			return fmt.Errorf("%w: entry %q uses method %d", ErrCannotSkip, e.Name, e.Method)
+		}
+		var err error
+		if r, err = e.Open(); err != nil {
+			return err
+		}
+	}
+	if cr, ok := r.(*checksumReader); ok {
+		return cr.drain()
+	}
+	_, err := io.Copy(io.Discard, r)
+	return err
 }
 
 type Reader struct {
-	r            io.Reader
+	readerSettings
+
+	r            *bufio.Reader
+	src          *sourceReader
 	localFileEnd bool
 	curEntry     *Entry
+	maxPrefix    int
+	prefixLen    int64
+	entryCount   int
+	expectCount  int
+
+	sawCentralDir  bool
+	archiveHash    hash.Hash
+	ownSource      bool
+	drainable      bool   // see Reader.Drain
+	unread         []byte // the signature of the record which ended the iteration
+	warnings       []ParseWarning
+	concatenated   bool
+	archiveIndex   int
+	trailingBlocks [][]byte
+	stats          ReaderStats
+	report         StreamabilitySummary
+
+	readCentralDir bool
+	entries        []*Entry // entries retained until the central directory is read
+	centralDir     []DirectoryEntry
+	localRecords   []localRecord
+	archiveStart   int64 // stream offset of the current archive
+	comment        string
+
+	interleavedOffset int64 // stream offset of a local file header within the central directory, see ErrInterleavedRecords
+	streamSize        int64 // size of the stream, -1 if unknown
+
+	names        map[string]string // folded name to the name of the first entry, see WithDuplicateDetection
+	manifestSeen []bool
+
+	collector StatsCollector // see WithStats
+	started   bool           // the collector was told the archive started
+	finished  bool           // the collector was told the archive finished
+}
+
+// readerSettings holds the options deciding how the entries are read and
+// checked, which the readers of Reader.SortedEntries inherit.
+type readerSettings struct {
+	allowMissingDir bool
+	stripAlignment  bool
+	maxPadding      int
+	strict          bool
+	allowPadding    bool
+	tolerateTrailer bool
+	manualSkip      bool
+	scanSignature   bool
+	rawBufSize      int          // see WithRawBufferSize
+	onSizes         func(*Entry) // see WithDescriptorCallback
+	expectSig       bool
+	rejectControl   bool
+	signingBlocks   bool
+
+	decompressors map[uint16]zip.Decompressor // see Reader.RegisterDecompressor
+	newChecksum   func() hash.Hash32          // nil for CRC32, see Reader.SetChecksumHash
+	hashers       map[string]func() hash.Hash // see WithHashers
+
+	dupMode DuplicateMode
+
+	manifest       []ManifestEntry // see WithManifest
+	manifestIndex  map[string]int  // sanitized name to the index of its manifest entry
+	manifestStrict bool
+}
+
+// ReaderStats holds counters accumulated while iterating the entries.
+type ReaderStats struct {
+	Entries                     int            // number of entries read
+	WithDataDescriptor          int            // entries whose sizes are in a data descriptor
+	WithoutDataDescriptor       int            // entries whose sizes are in the local header
+	Zip64                       int            // entries with a Zip64 extra field
+	Methods                     map[uint16]int // number of entries per compression method
+	DescriptorsWithSignature    int            // data descriptors read starting with the optional signature
+	DescriptorsWithoutSignature int            // data descriptors read without signature
+}
+
+// Option configures optional behaviors of a Reader.
+type Option func(z *Reader)
+
+// WithHeaderScan tolerates up to maxPrefix bytes of arbitrary data before the
+// first local file header, such as the executable stub of a self-extracting
+// archive. The skipped length is reported by Reader.PrefixLength. The first
+// local file header must have a file name and a version needed to extract of
+// at most 6.3 even outside strict mode, the scan would otherwise stop at the
+// signature bytes found in the code of such stubs.
+func WithHeaderScan(maxPrefix int) Option {
+	return func(z *Reader) {
+		z.maxPrefix = maxPrefix
+	}
+}
+
+// WithExpectedStreamSize sets the size of the stream, e.g. the Content-Length
+// of a download, so that an entry whose compressed size exceeds the rest of
+// the stream fails as soon as its header is read, with a *TruncatedError
+// naming the entry and the bytes missing. The size of a source implementing
+// Len() int or Size() int64, such as a bytes.Reader, is known without it.
+func WithExpectedStreamSize(n int64) Option {
+	return func(z *Reader) {
+		z.streamSize = n
+	}
+}
+
+// WithAllowMissingDirectory accepts streams that end right after the last
+// entry without a central directory, which then end with io.EOF rather than
+// ErrTruncated. A stream ending inside an entry is still ErrTruncated.
+func WithAllowMissingDirectory() Option {
+	return func(z *Reader) {
+		z.allowMissingDir = true
+	}
+}
+
+// WithArchiveHash hashes every byte read from the stream, headers and central
+// directory included, with the hash returned by newHash. The sum is returned
+// by Reader.ArchiveHashSum.
+func WithArchiveHash(newHash func() hash.Hash) Option {
+	return func(z *Reader) {
+		z.archiveHash = newHash()
+	}
+}
+
+// WithManualSkip makes GetNextEntry return ErrEntryNotConsumed instead of
+// skipping the unread data of the current entry, which must then be read to
+// its end or discarded with Entry.Skip. Closing the reader returned by Open
+// doesn't consume the entry.
+func WithManualSkip() Option {
+	return func(z *Reader) {
+		z.manualSkip = true
+	}
+}
+
+// WithSigningBlocks reads an APK Signing Block found after the last entry,
+// returned by Reader.TrailingBlocks. The block is buffered whole, up to 16 MiB
+// as declared by its leading size, before its magic can be checked. Without
+// this option such a block is an unknown record, see SetTolerateUnknownTrailer.
+func WithSigningBlocks() Option {
+	return func(z *Reader) {
+		z.signingBlocks = true
+	}
 }
 
-func NewReader(r io.Reader) *Reader {
-	return &Reader{
-		r: r,
+// WithInterEntryPadding tolerates up to max zero bytes between the end of an
+// entry and the next signature, as inserted by some aligners.
+func WithInterEntryPadding(max int) Option {
+	return func(z *Reader) {
+		z.maxPadding = max
+	}
+}
+
+// DefaultRawBufferSize is the size of the buffer receiving the discarded
+// output of the decompressor with which Entry.OpenRaw finds the end of the
+// data of an entry with data descriptor, see WithRawBufferSize.
+const DefaultRawBufferSize = 32 << 10
+
+// WithRawBufferSize sets the size of the buffer receiving the discarded
+// output of the decompressor with which Entry.OpenRaw finds the end of the
+// data of an entry with data descriptor. A larger buffer means fewer, larger
+// reads of the compressed data. A size <= 0 selects DefaultRawBufferSize.
+func WithRawBufferSize(n int) Option {
+	return func(z *Reader) {
+		if n <= 0 {
+			n = DefaultRawBufferSize
+		}
+		z.rawBufSize = n
+	}
+}
+
+// WithHashers computes additional digests of the decompressed data of the
+// entries read with Open or a variant, such as SHA-256 or MD5 for a manifest.
+// A hash is created for each entry with the function registered under its
+// name, the digests are returned by Entry.Digest once the data has been read
+// to its end.
+func WithHashers(hashers map[string]func() hash.Hash) Option {
+	return func(z *Reader) {
+		z.hashers = hashers
+	}
+}
+
+// WithDescriptorCallback sets a function invoked once the final CRC32 and
+// sizes of an entry are known: when the data descriptor of an entry with
+// data descriptor has been read, and when the end of the data of a sized
+// entry has been reached, with the values of the local header. It is invoked
+// by the reader returned by Open or OpenRaw before that reader returns
+// io.EOF or the error of the verification of the CRC32 and the sizes, so the
+// values it is given are not verified yet, and by GetNextEntry or Entry.Skip
+// when they read the end of an entry. It is invoked at most once per entry, in
+// the goroutine reading the entry.
+func WithDescriptorCallback(fn func(e *Entry)) Option {
+	return func(z *Reader) {
+		z.onSizes = fn
+	}
+}
+
+// NewReader returns a Reader of the ZIP stream read from r. The stream starts
+// at the current position of r, which doesn't need to be the start of a file:
+// bytes already consumed from r, e.g. to sniff its format, are not read
+// again. See Reader.SetExpectSignature to check that a local file header
+// starts the stream.
+func NewReader(r io.Reader, opts ...Option) *Reader {
+	src := &sourceReader{r: r}
+	z := &Reader{
+		r:          bufio.NewReader(src),
+		src:        src,
+		streamSize: -1,
+	}
+	z.rawBufSize = DefaultRawBufferSize
+	// the size of an in-memory source is known
+	switch sr := r.(type) {
+	case interface{ Len() int }:
+		z.streamSize = int64(sr.Len())
+	case interface{ Size() int64 }:
+		z.streamSize = sr.Size()
+	}
+	for _, opt := range opts {
+		opt(z)
+	}
+	src.hash = z.archiveHash
+	return z
+}
+
+// ArchiveHashSum reads the rest of the stream after the entries, and returns
+// the hash set by WithArchiveHash of the whole stream. It returns nil if no
+// hash is set, the entries have not been read to the end or the rest of the
+// stream can't be read.
+func (z *Reader) ArchiveHashSum() []byte {
+	if z.archiveHash == nil || !z.localFileEnd {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, z.r); err != nil {
+		return nil
+	}
+	return z.archiveHash.Sum(nil)
+}
+
+// ExpectEntries sets the number of entries the archive must contain, reaching
+// the end of the archive with fewer entries returns ErrIncompleteArchive
+// instead of io.EOF.
+func (z *Reader) ExpectEntries(n int) {
+	z.expectCount = n
+}
+
+// SetStripAlignmentExtras sets whether the extra fields only used to pad and
+// align the entry data, such as the JAR marker, the zipalign padding and
+// zero padding, are removed from Entry.Extra. They are kept by default.
+func (z *Reader) SetStripAlignmentExtras(strip bool) {
+	z.stripAlignment = strip
+}
+
+// SetStrict sets whether deviations from the specification, which are
+// tolerated by default, are reported as errors. In strict mode an extra field
+// whose declared size exceeds the extra area is a *FormatError.
+func (z *Reader) SetStrict(strict bool) {
+	z.strict = strict
+}
+
+// SetAllowTrailingPadding sets whether bytes left within the compressed size
+// of an entry once its compressed data ends, as written by some producers,
+// are tolerated. They are reported as a *FormatError by default.
+func (z *Reader) SetAllowTrailingPadding(allow bool) {
+	z.allowPadding = allow
+}
+
+// SetTolerateUnknownTrailer sets whether an unknown record after the last
+// entry, such as an unrecognized signing block, ends the iteration like the
+// central directory does, rather than being reported as zip.ErrFormat.
+func (z *Reader) SetTolerateUnknownTrailer(tolerate bool) {
+	z.tolerateTrailer = tolerate
+}
+
+// SetEntrySignatureScan sets whether the bytes following an entry are scanned
+// for the next local file header or central directory signature, for the
+// upload protocols interleaving the entries with their own markers. At most
+// MaxEntrySignatureScan bytes are skipped after each entry, they are reported
+// by a WarnInterstitialSkipped warning.
+func (z *Reader) SetEntrySignatureScan(scan bool) {
+	z.scanSignature = scan
+}
+
+// SetExpectSignature sets whether the first GetNextEntry checks that the
+// stream starts with a local file header signature, possibly preceded by the
+// spanning marker of a split archive, or with the end of central directory
+// record of an empty archive, and fails early with ErrNotZip if it doesn't,
+// e.g. for a source which is not a ZIP stream or is not positioned at its
+// start. It has no effect with WithHeaderScan, which tolerates a prefix.
+func (z *Reader) SetExpectSignature(expect bool) {
+	z.expectSig = expect
+}
+
+// SetChecksumHash sets the hash computed over the decompressed data of the
+// entries read with Open, such as adler32.New for formats needing an Adler-32
+// checksum, its sum is returned by Entry.ChecksumSum. With a hash other than
+// the default CRC32 the data is not verified against Entry.CRC32, and
+// ObservedCRC32 and ComputedCRC32 are not set. A nil newHash restores CRC32.
+func (z *Reader) SetChecksumHash(newHash func() hash.Hash32) {
+	z.newChecksum = newHash
+}
+
+// SetRejectControlChars sets whether an entry whose name contains a NUL byte
+// or another control character, as found in malicious archives, is rejected
+// with a *FormatError. Such names are accepted by default.
+func (z *Reader) SetRejectControlChars(reject bool) {
+	z.rejectControl = reject
+}
+
+// TrailingBlocks returns the raw blocks found between the last entry and the
+// central directory, such as the APK Signing Block, including their leading
+// size field. Signing blocks are only read with WithSigningBlocks.
+func (z *Reader) TrailingBlocks() [][]byte {
+	return z.trailingBlocks
+}
+
+// Stats returns the counters accumulated so far.
+func (z *Reader) Stats() ReaderStats {
+	stats := z.stats
+	stats.Methods = make(map[uint16]int, len(z.stats.Methods))
+	for method, n := range z.stats.Methods {
+		stats.Methods[method] = n
+	}
+	return stats
+}
+
+// CurrentEntry returns the entry last returned by GetNextEntry, or last
+// rejected by it with a *ManifestError or a *FormatError for its name, nil
+// before the first one.
+func (z *Reader) CurrentEntry() *Entry {
+	return z.curEntry
+}
+
+// SawCentralDirectory reports whether the end of the entries was marked by
+// the central directory or the end of central directory record.
+func (z *Reader) SawCentralDirectory() bool {
+	return z.sawCentralDir
+}
+
+// SupportsMethod reports whether a decompressor is registered for the
+// compression method, so that the entries using it can be opened.
+func (z *Reader) SupportsMethod(method uint16) bool {
+	return z.decompressor(method) != nil
+}
+
+// IsEmpty reports whether the iteration has ended without any entry, i.e.
+// the archive holds no entry.
+func (z *Reader) IsEmpty() bool {
+	return z.localFileEnd && z.entryCount == 0
+}
+
+// PrefixLength returns the number of bytes skipped before the first local file header.
+func (z *Reader) PrefixLength() int64 {
+	return z.prefixLen
+}
+
+// skipPrefix discards bytes until a plausible local file header is found,
+// at most z.maxPrefix bytes are skipped.
+func (z *Reader) skipPrefix() error {
+	for {
+		buf, _ := z.r.Peek(headerIdentifierLen + fileHeaderLen)
+		if len(buf) < headerIdentifierLen+fileHeaderLen || isFileHeader(buf) {
+			// leave a short stream to the regular header parsing
+			return nil
+		}
+		if z.prefixLen >= int64(z.maxPrefix) {
+			return ErrPrefixTooLong
+		}
+		if _, err := z.r.Discard(1); err != nil {
+			return err
+		}
+		z.prefixLen++
 	}
 }
 
+// skipToSignature discards the bytes before the next local file header or
+// central directory signature, at most MaxEntrySignatureScan bytes.
+func (z *Reader) skipToSignature() error {
+	offset := z.offset()
+	n := 0
+	for {
+		buf, _ := z.r.Peek(headerIdentifierLen + fileHeaderLen)
+		if len(buf) < headerIdentifierLen || isFileHeader(buf) {
+			// leave a short stream to the regular signature read
+			break
+		}
+		sig := binary.LittleEndian.Uint32(buf)
+		if sig == directoryHeaderSignature || sig == directoryEndSignature || sig == directory64EndSignature {
+			break
+		}
+		if n >= MaxEntrySignatureScan {
+			return &FormatError{
+				Name:   z.curEntry.Name,
+				Offset: offset,
+				Msg:    fmt.Sprintf("no signature within %d bytes after the entry data", n),
+			}
+		}
+		if _, err := z.r.Discard(1); err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		z.warn(WarnInterstitialSkipped, offset, "%d bytes after entry %q", n, z.curEntry.Name)
+	}
+	return nil
+}
+
+// isFileHeader reports whether buf starts with a local file header whose
+// fixed fields look sane, so that stray signature bytes are not mistaken
+// for the start of the archive. It rejects the empty names and the versions
+// above maxReaderVersion in every mode: readEntry only warns about them
+// outside strict mode, but the scans relying on isFileHeader would find
+// many more false headers without these checks.
+func isFileHeader(buf readBuf) bool {
+	if buf.uint32() != fileHeaderSignature {
+		return false
+	}
+	readerVersion := buf.uint16()
+	buf.uint16() // flags
+	method := buf.uint16()
+	buf.sub(16) // modified time and date, crc32, sizes
+	filenameLen := buf.uint16()
+	return readerVersion&0xff <= maxReaderVersion && method <= 99 && filenameLen > 0
+}
+
 func (z *Reader) readEntry() (*Entry, error) {
+	headerOffset := z.offset() - headerIdentifierLen
+	headerError := func(name, field string, value uint64, err error) error {
+		return &HeaderError{Index: z.entryCount, Offset: headerOffset, Name: name, Field: field, Value: value, Err: err}
+	}
 
 	buf := make([]byte, fileHeaderLen)
 	if _, err := io.ReadFull(z.r, buf); err != nil {
-		return nil, fmt.Errorf("unable to read local file header: %w", err)
+		return nil, fmt.Errorf("unable to read local file header: %w", z.truncated(err, structFileHeader))
 	}
 
 	lr := readBuf(buf)
@@ -108,6 +1258,7 @@ func (z *Reader) readEntry() (*Entry, error) {
 	extraAreaLen := int(lr.uint16())
 
 	entry := &Entry{
+		index: z.entryCount,
 		FileHeader: zip.FileHeader{
 			ReaderVersion:      readerVersion,
 			Flags:              flags,
@@ -120,37 +1271,82 @@ func (z *Reader) readEntry() (*Entry, error) {
 			CompressedSize64:   uint64(compressedSize),
 			UncompressedSize64: uint64(uncompressedSize),
 		},
-		r:          z.r,
-		hasReadNum: 0,
-		eof:        false,
+		ArchiveIndex: z.archiveIndex,
+		headerOffset: headerOffset,
+		z:            z,
+		r:            z.r,
+		crcKnown:     flags&8 == 0,
+		eof:          false,
+	}
+
+	if readerVersion&0xff > maxReaderVersion {
+		if z.strict {
+			return nil, headerError("", "version needed to extract", uint64(readerVersion), nil)
+		}
+		entry.warn(WarnReaderVersion, headerOffset+4, "version needed to extract %d is above %d", readerVersion&0xff, maxReaderVersion)
+	}
+	if filenameLen == 0 {
+		if z.strict {
+			return nil, headerError("", "file name length", 0, nil)
+		}
+		entry.warn(WarnEmptyName, headerOffset+26, "the file name is empty")
 	}
 
 	nameAndExtraBuf := make([]byte, filenameLen+extraAreaLen)
-	if _, err := io.ReadFull(z.r, nameAndExtraBuf); err != nil {
-		return nil, fmt.Errorf("unable to read entry name and extra area: %w", err)
+	if n, err := io.ReadFull(z.r, nameAndExtraBuf); err != nil {
+		if n < filenameLen {
+			// the stream ends before the file name does
+			return nil, headerError("", "file name length", uint64(filenameLen), z.truncated(err, structNameExtra))
+		}
+		return nil, fmt.Errorf("unable to read entry name and extra area: %w", z.truncated(err, structNameExtra))
 	}
 
 	entry.Name = string(nameAndExtraBuf[:filenameLen])
+	// the buffer is allocated per entry, Extra keeps the exact bytes of the
+	// extra area for re-emission once the following entries are read
 	entry.Extra = nameAndExtraBuf[filenameLen:]
 
+	if z.rejectControl {
+		if i := strings.IndexFunc(entry.Name, unicode.IsControl); i >= 0 {
+			r, _ := utf8.DecodeRuneInString(entry.Name[i:])
+			return nil, &FormatError{
+				Name:   entry.Name,
+				Offset: headerOffset + headerIdentifierLen + fileHeaderLen + int64(i),
+				Msg:    fmt.Sprintf("control character %U in the file name", r),
+			}
+		}
+	}
+	entry.Insecure = !isLocalName(entry.Name)
+	entry.ReservedName = hasReservedName(entry.Name)
 	entry.NonUTF8 = flags&0x800 == 0
-	if flags&1 == 1 {
-		return nil, fmt.Errorf("encrypted ZIP entry not supported")
+	if !entry.NonUTF8 && !utf8.ValidString(entry.Name) {
+		entry.warn(WarnInvalidUTF8Name, headerOffset+headerIdentifierLen+fileHeaderLen, "the name is flagged UTF-8 but isn't valid UTF-8")
 	}
-	if flags&8 == 8 && method != CompressMethodDeflated {
-		return nil, fmt.Errorf("only DEFLATED entries can have data descriptor")
+	if err := entry.checkFlags(); err != nil {
+		return nil, err
 	}
-
 	needCSize := entry.CompressedSize == ^uint32(0)
 	needUSize := entry.UncompressedSize == ^uint32(0)
 
 	ler := readBuf(entry.Extra)
-	var modified time.Time
+	// Several extra fields may carry the modification time, the most precise
+	// one is used: NTFS (100ns) > extended timestamp > Info-ZIP Unix > MS-DOS.
+	var ntfsModified, extModified, unixModified time.Time
 parseExtras:
 	for len(ler) >= 4 { // need at least tag and size
 		fieldTag := ler.uint16()
 		fieldSize := int(ler.uint16())
 		if len(ler) < fieldSize {
+			if z.strict {
+				return nil, &FormatError{
+					Name:   entry.Name,
+					Offset: z.offset() - int64(len(ler)) - 4,
+					Msg:    fmt.Sprintf("extra field 0x%04x declares %d bytes but only %d remain", fieldTag, fieldSize, len(ler)),
+				}
+			}
+			entry.warn(WarnTruncatedExtra, z.offset()-int64(len(ler))-4,
+				"extra field 0x%04x declares %d bytes but only %d remain", fieldTag, fieldSize, len(ler))
+			ler = nil
 			break
 		}
 		fieldBuf := ler.sub(fieldSize)
@@ -189,16 +1385,17 @@ parseExtras:
 					continue parseExtras
 				}
 				attrBuf := fieldBuf.sub(attrSize)
-				if attrTag != 1 || attrSize != 24 {
+				// the three timestamps are read from the attribute
+				// itself, which must hold exactly their 24 bytes
+				if attrTag != 1 || len(attrBuf) != 24 {
 					continue // Ignore irrelevant attributes
 				}
 
-				const ticksPerSecond = 1e7    // Windows timestamp resolution
-				ts := int64(attrBuf.uint64()) // ModTime since Windows epoch
-				secs := ts / ticksPerSecond
-				nsecs := (1e9 / ticksPerSecond) * int64(ts%ticksPerSecond)
-				epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
-				modified = time.Unix(epoch.Unix()+secs, nsecs)
+				// ModTime, AcTime and CrTime since Windows epoch
+				ntfsModified = ntfsTime(attrBuf.uint64())
+				entry.ntfsAccessed = ntfsTime(attrBuf.uint64())
+				entry.ntfsCreated = ntfsTime(attrBuf.uint64())
+				entry.ntfsModified = ntfsModified
 			}
 		case UnixExtraID, InfoZipUnixExtraID:
 			if len(fieldBuf) < 8 {
@@ -206,16 +1403,52 @@ parseExtras:
 			}
 			fieldBuf.uint32()              // AcTime (ignored)
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
-			modified = time.Unix(ts, 0)
+			unixModified = time.Unix(ts, 0)
+		case InfoZipUnix2ExtraID:
+			// the uid and gid are only present in the local header
+			if len(fieldBuf) < 4 {
+				continue parseExtras
+			}
+			entry.uid = int(fieldBuf.uint16())
+			entry.gid = int(fieldBuf.uint16())
+			entry.hasOwner = true
+		case AsiUnixExtraID:
+			if len(fieldBuf) < 6 {
+				continue parseExtras
+			}
+			fieldBuf.uint32() // CRC32 of the rest of the field (ignored)
+			entry.asiMode = uint32(fieldBuf.uint16())
+			entry.hasAsiMode = true
 		case ExtTimeExtraID:
 			if len(fieldBuf) < 5 || fieldBuf.uint8()&1 == 0 {
 				continue parseExtras
 			}
 			ts := int64(fieldBuf.uint32()) // ModTime since Unix epoch
-			modified = time.Unix(ts, 0)
+			extModified = time.Unix(ts, 0)
+		case ZipAlignExtraID:
+			// alignment (uint16) followed by zero padding, nothing to parse
+		default:
+			if z.strict && isPKWareExtra(fieldTag) {
+				entry.unsupportedExtras = append(entry.unsupportedExtras, fieldTag)
+			}
 		}
 	}
 
+	if len(ler) > 0 && len(ler) < 4 {
+		entry.warn(WarnExtraTrailingData, z.offset()-int64(len(ler)), "%d bytes after the last extra field", len(ler))
+	}
+
+	modified := ntfsModified
+	if modified.IsZero() {
+		modified = extModified
+	}
+	if modified.IsZero() {
+		modified = unixModified
+	}
+
+	if entry.ModifiedDate == 0 && entry.ModifiedTime == 0 {
+		entry.warn(WarnZeroDOSTime, headerOffset+10, "the MS-DOS modification time is zero")
+	}
 	msDosModified := MSDosTimeToTime(entry.ModifiedDate, entry.ModifiedTime)
 	entry.Modified = msDosModified
 
@@ -236,82 +1469,331 @@ parseExtras:
 	}
 
 	if needCSize {
-		return nil, zip.ErrFormat
+		return nil, headerError(entry.Name, "compressed size", uint64(entry.CompressedSize), errors.New("no zip64 extra field"))
+	}
+	if needUSize && z.strict {
+		return nil, headerError(entry.Name, "uncompressed size", uint64(entry.UncompressedSize), errors.New("no zip64 extra field"))
+	}
+	if z.strict && entry.IsDir() && entry.UncompressedSize64 != 0 {
+		return nil, headerError(entry.Name, "uncompressed size of directory", entry.UncompressedSize64, nil)
 	}
 
-	entry.lr = io.LimitReader(z.r, int64(entry.CompressedSize64))
+	if z.stripAlignment {
+		entry.Extra = stripAlignmentExtras(entry.Extra)
+	}
+
+	entry.dataOffset = z.offset()
+	if entry.hasDataDescriptor() && method == CompressMethodStored {
+		// Nothing marks the end of STORED data but the data descriptor,
+		// as written by zip.Writer and by macOS Archive Utility for
+		// directories, it is looked for in the data.
+		entry.lr = &countReader{r: bufio.NewReader(&storedReader{r: z.r, hash: crc32.NewIEEE(), padding: z.maxPadding > 0})}
+	} else if entry.hasDataDescriptor() {
+		// The sizes are unknown until the data descriptor has been read,
+		// the decompressor itself has to find the end of the entry data.
+		entry.lr = &countReader{r: z.r}
+	} else {
+		remaining := z.streamSize - entry.dataOffset
+		if remaining < 0 {
+			remaining = 0
+		}
+		if z.streamSize >= 0 && entry.CompressedSize64 > uint64(remaining) {
+			return nil, &TruncatedError{
+				Offset:    z.streamSize,
+				Structure: structEntryData,
+				Name:      entry.Name,
+				Missing:   int64(entry.CompressedSize64 - uint64(remaining)),
+			}
+		}
+		entry.lr = io.LimitReader(z.r, int64(entry.CompressedSize64))
+	}
 
 	return entry, nil
 }
 
+// skipPadding discards up to z.maxPadding zero bytes. No signature starts
+// with a zero byte, so the padding can't be mistaken for a record.
+func (z *Reader) skipPadding() error {
+	offset := z.offset()
+	n := 0
+	for ; n < z.maxPadding; n++ {
+		b, err := z.r.Peek(1)
+		if err != nil || b[0] != 0 {
+			// errors are left to the signature read
+			break
+		}
+		if _, err := z.r.Discard(1); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		z.warn(WarnPaddingSkipped, offset, "%d zero bytes after entry %q", n, z.curEntry.Name)
+	}
+	return nil
+}
+
+// readSigningBlock reads an APK Signing Block if the next bytes are not a
+// known signature. A size out of bounds is left to the signature check to
+// fail, a block without the trailing size and magic is zip.ErrFormat.
+func (z *Reader) readSigningBlock() error {
+	buf, _ := z.r.Peek(8)
+	if len(buf) < 8 {
+		return nil
+	}
+	switch binary.LittleEndian.Uint32(buf) {
+	case fileHeaderSignature, directoryHeaderSignature, directoryEndSignature, directory64EndSignature, archiveExtraDataSignature:
+		return nil
+	}
+	size := binary.LittleEndian.Uint64(buf)
+	if size < uint64(minSigningBlockSize) || size > maxSigningBlockSize {
+		return nil
+	}
+	block := make([]byte, 8+size)
+	if _, err := io.ReadFull(z.r, block); err != nil {
+		return z.truncated(err, structSigningBlock)
+	}
+	trailer := block[len(block)-minSigningBlockSize:]
+	if binary.LittleEndian.Uint64(trailer) != size || string(trailer[8:]) != signingBlockMagic {
+		return zip.ErrFormat
+	}
+	z.trailingBlocks = append(z.trailingBlocks, block)
+	return nil
+}
+
+// ntfsTime converts a timestamp in 100ns ticks since the Windows epoch.
+func ntfsTime(ticks uint64) time.Time {
+	const ticksPerSecond = 1e7 // Windows timestamp resolution
+	ts := int64(ticks)
+	secs := ts / ticksPerSecond
+	nsecs := (1e9 / ticksPerSecond) * int64(ts%ticksPerSecond)
+	epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return time.Unix(epoch.Unix()+secs, nsecs)
+}
+
+// stripAlignmentExtras returns extra without the fields used for alignment.
+func stripAlignmentExtras(extra []byte) []byte {
+	stripped := make([]byte, 0, len(extra))
+	b := readBuf(extra)
+	for len(b) >= 4 {
+		field := b
+		fieldTag := b.uint16()
+		fieldSize := int(b.uint16())
+		if len(b) < fieldSize {
+			// keep a malformed trailing field as it is
+			return append(stripped, field...)
+		}
+		b.sub(fieldSize)
+		switch fieldTag {
+		case JarMarkerExtraID, ZipAlignExtraID, paddingExtraID:
+			continue
+		}
+		stripped = append(stripped, field[:4+fieldSize]...)
+	}
+	return append(stripped, b...)
+}
+
+// GetNextEntry skips the remaining data of the current entry and returns the
+// next one, or io.EOF once the local entries end. The returned Entry is never
+// reused, its fields such as Extra remain valid after the following calls.
 func (z *Reader) GetNextEntry() (*Entry, error) {
+	if z.collector == nil {
+		return z.getNextEntry()
+	}
+	if !z.started {
+		z.started = true
+		z.collector.ArchiveStarted()
+	}
+	entry, err := z.getNextEntry()
+	if err == io.EOF && !z.finished {
+		z.finished = true
+		z.collector.ArchiveFinished()
+	}
+	return entry, err
+}
+
+func (z *Reader) getNextEntry() (*Entry, error) {
+	if atomic.LoadInt32(&z.src.closed) != 0 {
+		return nil, ErrClosed
+	}
+	if z.curEntry != nil && atomic.LoadInt32(&z.curEntry.reading) != 0 {
+		return nil, fmt.Errorf("%w: entry %q", ErrEntryInUse, z.curEntry.Name)
+	}
 	if z.localFileEnd {
 		return nil, io.EOF
 	}
-	if z.curEntry != nil && !z.curEntry.eof {
-		if z.curEntry.hasReadNum <= z.curEntry.UncompressedSize64 {
-			if _, err := io.Copy(io.Discard, z.curEntry.lr); err != nil {
-				return nil, fmt.Errorf("read previous file data fail: %w", err)
-			}
-			if z.curEntry.hasDataDescriptor() {
-				if err := readDataDescriptor(z.r, z.curEntry); err != nil {
-					return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-				}
-			}
-		} else {
-			if !z.curEntry.hasDataDescriptor() {
-				return nil, errors.New("parse error, read position exceed entry")
-			}
-
-			readDataLen := z.curEntry.hasReadNum - z.curEntry.UncompressedSize64
-			if readDataLen > dataDescriptorLen {
-				return nil, errors.New("parse error, read position exceed entry")
-			} else if readDataLen > dataDescriptorLen-4 {
-				if z.curEntry.hasDataDescriptorSignature {
-					if _, err := io.Copy(io.Discard, io.LimitReader(z.r, int64(dataDescriptorLen-readDataLen))); err != nil {
-						return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-					}
-				} else {
-					return nil, errors.New("parse error, read position exceed entry")
-				}
-			} else {
-				buf := make([]byte, dataDescriptorLen-readDataLen)
-				if _, err := io.ReadFull(z.r, buf); err != nil {
-					return nil, fmt.Errorf("read previous entry's data descriptor fail: %w", err)
-				}
-				buf = buf[len(buf)-4:]
-				headerID := binary.LittleEndian.Uint32(buf)
-
-				// read to next record head
-				if headerID == fileHeaderSignature ||
-					headerID == directoryHeaderSignature ||
-					headerID == directoryEndSignature {
-					z.r = io.MultiReader(bytes.NewReader(buf), z.r)
-				}
+	if z.offset() == 0 && z.expectSig && z.maxPrefix == 0 {
+		if err := z.checkSignature(); err != nil {
+			return nil, err
+		}
+	}
+	if z.offset() == 0 {
+		// the spanning marker is only valid at the very start of the stream
+		if buf, _ := z.r.Peek(headerIdentifierLen); len(buf) == headerIdentifierLen &&
+			binary.LittleEndian.Uint32(buf) == spanningMarkerSignature {
+			if _, err := z.r.Discard(headerIdentifierLen); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if z.curEntry == nil && z.maxPrefix > 0 && z.prefixLen == 0 {
+		if err := z.skipPrefix(); err != nil {
+			return nil, err
+		}
+		if z.prefixLen > 0 {
+			z.warn(WarnPrefixSkipped, 0, "%d bytes before the first local file header", z.prefixLen)
+		}
+	}
+	if z.curEntry != nil && !z.curEntry.eof {
+		if z.manualSkip && !z.curEntry.consumed() {
+			return nil, fmt.Errorf("%w: entry %q", ErrEntryNotConsumed, z.curEntry.Name)
+		}
+		start := z.offset()
+		if err := z.curEntry.skip(); err != nil {
+			return nil, fmt.Errorf("read previous file data fail: %w", err)
+		}
+		z.curEntry.skipped = z.offset() - start
+	}
+	if z.curEntry != nil && z.collector != nil {
+		z.entryDone(z.curEntry)
+	}
+	if z.curEntry != nil && z.curEntry.manifest != nil {
+		if err := z.checkManifestData(z.curEntry); err != nil {
+			return nil, err
+		}
+	}
+	if z.curEntry != nil && z.maxPadding > 0 {
+		if err := z.skipPadding(); err != nil {
+			return nil, err
+		}
+	}
+	if z.curEntry != nil && z.scanSignature {
+		if err := z.skipToSignature(); err != nil {
+			return nil, err
+		}
+	}
+	if z.curEntry != nil && z.signingBlocks {
+		if err := z.readSigningBlock(); err != nil {
+			if err == zip.ErrFormat && z.tolerateTrailer {
+				// a block sized like a signing block, without its magic
+				z.localFileEnd = true
+				return nil, z.endOfEntries()
 			}
+			return nil, err
 		}
-		z.curEntry.eof = true
 	}
 	headerIDBuf := make([]byte, headerIdentifierLen)
 	if _, err := io.ReadFull(z.r, headerIDBuf); err != nil {
-		return nil, fmt.Errorf("unable to read header identifier: %w", err)
+		if err == io.EOF && z.curEntry == nil && z.prefixLen == 0 {
+			return nil, ErrEmptyStream
+		}
+		if err == io.EOF && z.curEntry != nil {
+			// the stream ended right after an entry
+			if z.allowMissingDir {
+				z.localFileEnd = true
+				return nil, z.endAt(nil)
+			}
+			return nil, fmt.Errorf("unable to read header identifier: %w", z.truncated(err, structCentralDir))
+		}
+		return nil, fmt.Errorf("unable to read header identifier: %w", z.truncated(err, structSignature))
 	}
 	headerID := binary.LittleEndian.Uint32(headerIDBuf)
 	if headerID != fileHeaderSignature {
-		if headerID == directoryHeaderSignature || headerID == directoryEndSignature {
+		if headerID == directoryHeaderSignature || headerID == directoryEndSignature || headerID == directory64EndSignature {
+			z.sawCentralDir = true
+			if z.concatenated {
+				return z.nextArchive(headerID)
+			}
+			z.localFileEnd = true
+			if z.readCentralDir {
+				sig := headerID
+				if sig == directoryHeaderSignature {
+					var err error
+					if sig, err = z.readCentralDirectory(); err != nil {
+						return nil, fmt.Errorf("unable to read central directory: %w", err)
+					}
+				}
+				if err := z.readDirectoryEnd(sig); err != nil {
+					return nil, fmt.Errorf("unable to read end of central directory: %w", err)
+				}
+				return nil, z.endOfEntries()
+			}
+			return nil, z.endAt(headerIDBuf)
+		}
+		if headerID == archiveExtraDataSignature {
+			z.localFileEnd = true
+			return nil, ErrCentralDirEncrypted
+		}
+		if z.tolerateTrailer && z.curEntry != nil {
 			z.localFileEnd = true
-			return nil, io.EOF
+			return nil, z.endAt(headerIDBuf)
 		}
 		return nil, zip.ErrFormat
 	}
 	entry, err := z.readEntry()
 	if err != nil {
-		return nil, fmt.Errorf("unable to read zip file header: %w", err)
+		return nil, &EntryError{
+			Index:  z.entryCount,
+			Offset: z.offset(),
+			Err:    fmt.Errorf("unable to read zip file header: %w", err),
+		}
 	}
+	// the data of an entry rejected below is skipped by the next call
 	z.curEntry = entry
+	if err := z.checkDuplicate(entry); err != nil {
+		return nil, err
+	}
+	if err := z.checkManifest(entry); err != nil {
+		return nil, err
+	}
+	z.entryCount++
+	if z.readCentralDir {
+		z.entries = append(z.entries, entry)
+	}
+	z.countEntry(entry)
+	z.classify(entry)
 	return entry, nil
 }
 
+func (z *Reader) countEntry(entry *Entry) {
+	z.stats.Entries++
+	if entry.hasDataDescriptor() {
+		z.stats.WithDataDescriptor++
+	} else {
+		z.stats.WithoutDataDescriptor++
+	}
+	if entry.zip64 {
+		z.stats.Zip64++
+	}
+	if z.stats.Methods == nil {
+		z.stats.Methods = make(map[uint16]int)
+	}
+	z.stats.Methods[entry.Method]++
+}
+
+// checkSignature checks that the stream starts with a local file header, see
+// SetExpectSignature.
+func (z *Reader) checkSignature() error {
+	buf, _ := z.r.Peek(headerIdentifierLen)
+	if len(buf) == 0 {
+		return ErrEmptyStream
+	}
+	if len(buf) == headerIdentifierLen {
+		switch binary.LittleEndian.Uint32(buf) {
+		case fileHeaderSignature, spanningMarkerSignature, directoryEndSignature:
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, it starts with %q", ErrNotZip, buf)
+}
+
+// endOfEntries returns the error ending the iteration after the last entry.
+func (z *Reader) endOfEntries() error {
+	if z.entryCount < z.expectCount {
+		return fmt.Errorf("%w: read %d of %d entries", ErrIncompleteArchive, z.entryCount, z.expectCount)
+	}
+	return io.EOF
+}
+
 var (
 	decompressors sync.Map // map[uint16]Decompressor
 )
@@ -321,6 +1803,24 @@ func init() {
 	decompressors.Store(zip.Deflate, zip.Decompressor(newFlateReader))
 }
 
+// RegisterDecompressor registers or overrides a decompressor for the
+// compression method for the entries of this Reader, like the method of
+// zip.Reader. The built-in decompressors, including the pooled Deflate one,
+// are used for the methods without a decompressor registered here.
+func (z *Reader) RegisterDecompressor(method uint16, dcomp zip.Decompressor) {
+	if z.decompressors == nil {
+		z.decompressors = make(map[uint16]zip.Decompressor)
+	}
+	z.decompressors[method] = dcomp
+}
+
+func (z *Reader) decompressor(method uint16) zip.Decompressor {
+	if dcomp := z.decompressors[method]; dcomp != nil {
+		return dcomp
+	}
+	return decompressor(method)
+}
+
 func decompressor(method uint16) zip.Decompressor {
 	di, ok := decompressors.Load(method)
 	if !ok {
@@ -331,19 +1831,34 @@ func decompressor(method uint16) zip.Decompressor {
 
 var flateReaderPool sync.Pool
 
+// outstandingFlateReaders counts the flate readers taken from the pool and
+// not returned yet, updated atomically. Each pooledFlateReader returns its
+// flate reader exactly once, when it is closed, so the count drops back once
+// the readers using them have been closed or released.
+var outstandingFlateReaders int64
+
 func newFlateReader(r io.Reader) io.ReadCloser {
+	return newFlateReaderDict(r, nil)
+}
+
+// newFlateReaderDict returns a pooled flate reader decompressing r with the
+// preset dictionary dict, nil if there is none.
+func newFlateReaderDict(r io.Reader, dict []byte) io.ReadCloser {
 	fr, ok := flateReaderPool.Get().(io.ReadCloser)
 	if ok {
-		fr.(flate.Resetter).Reset(r, nil)
+		fr.(flate.Resetter).Reset(r, dict)
 	} else {
-		fr = flate.NewReader(r)
+		fr = flate.NewReaderDict(r, dict)
 	}
-	return &pooledFlateReader{fr: fr}
+	atomic.AddInt64(&outstandingFlateReaders, 1)
+	return &pooledFlateReader{fr: fr, reused: ok}
 }
 
 type pooledFlateReader struct {
 	mu sync.Mutex // guards Close and Read
 	fr io.ReadCloser
+
+	reused bool // fr was taken from the pool
 }
 
 func (r *pooledFlateReader) Read(p []byte) (n int, err error) {
@@ -363,12 +1878,15 @@ func (r *pooledFlateReader) Close() error {
 		err = r.fr.Close()
 		flateReaderPool.Put(r.fr)
 		r.fr = nil
+		atomic.AddInt64(&outstandingFlateReaders, -1)
 	}
 	return err
 }
 
-func readDataDescriptor(r io.Reader, entry *Entry) error {
-	var buf [dataDescriptorLen]byte
+// readDataDescriptor reads the data descriptor following the entry data,
+// csize and usize are the compressed and uncompressed sizes observed while
+// reading the entry.
+func readDataDescriptor(r *bufio.Reader, entry *Entry, csize, usize uint64) error {
 	// The spec says: "Although not originally assigned a
 	// signature, the value 0x08074b50 has commonly been adopted
 	// as a signature value for the data descriptor record.
@@ -377,87 +1895,689 @@ func readDataDescriptor(r io.Reader, entry *Entry) error {
 	// descriptors and should account for either case when reading
 	// ZIP files to ensure compatibility."
 	//
-	// dataDescriptorLen includes the size of the signature but
-	// first read just those 4 bytes to see if it exists.
-	n, err := io.ReadFull(r, buf[:4])
-	entry.hasReadNum += uint64(n)
-	if err != nil {
+	// Peek the longest descriptor and the record following it. Nothing
+	// is consumed on a read error, so that a timeout can be retried.
+	buf, err := r.Peek(descriptorLookahead)
+	if err != nil && err != io.EOF {
 		return err
 	}
 	off := 0
-	maybeSig := readBuf(buf[:4])
-	if maybeSig.uint32() != dataDescriptorSignature {
-		// No data descriptor signature. Keep these four
-		// bytes.
-		off += 4
+	if len(buf) >= 4 && binary.LittleEndian.Uint32(buf) == dataDescriptorSignature {
+		off = 4
+		entry.z.stats.DescriptorsWithSignature++
 	} else {
-		entry.hasDataDescriptorSignature = true
+		entry.z.stats.DescriptorsWithoutSignature++
 	}
-	n, err = io.ReadFull(r, buf[off:12])
-	entry.hasReadNum += uint64(n)
-	if err != nil {
-		return err
+	body := buf[off:]
+
+	// The descriptor has 8-byte sizes when the local header has a zip64
+	// extra field, but some producers, e.g. java.util.zip in zip64 mode,
+	// write them without one. The layout whose sizes match the observed
+	// ones is used, otherwise the one implied by the local header.
+	candidate := descriptorCandidate{csize: csize, usize: usize, zip64: entry.zip64}
+	descriptorLen, _ := candidate.match(body, len(buf) < descriptorLookahead)
+	if descriptorLen == 0 {
+		descriptorLen = dataDescriptorLen - 4
+		if entry.zip64 {
+			descriptorLen = dataDescriptor64Len - 4
+		}
+	}
+	if len(body) < descriptorLen {
+		if _, err := r.Discard(len(buf)); err != nil {
+			return err
+		}
+		if len(buf) == 0 {
+			return io.EOF
+		}
+		return io.ErrUnexpectedEOF
+	}
+
+	// The descriptor is the only place holding the CRC32 and the sizes
+	// of the entry, the values in the local header are zero.
+	entry.CRC32, entry.CompressedSize64, entry.UncompressedSize64 = parseDataDescriptor(body[:descriptorLen])
+	entry.descriptorCRC = entry.CRC32
+	entry.crcKnown = true
+	_, err = r.Discard(off + descriptorLen)
+	return err
+}
+
+// descriptorCandidate holds the counters of the entry data against which a
+// data descriptor candidate is validated. It is the single place deciding
+// where entry data ends when that end is looked for in the stream.
+type descriptorCandidate struct {
+	crc          uint32 // CRC32 of the data, only checked if checkCRC
+	checkCRC     bool
+	csize, usize uint64
+	zip64        bool // try 8-byte sizes first
+}
+
+// match validates the candidate at the start of body, which excludes the
+// optional signature: the CRC32 and the sizes of a descriptor layout must
+// match the counters. A layout followed by the signature of a record, or by
+// the end of the stream if atEOF, is preferred. It returns the length of the
+// matching layout, 0 if none matches, and whether it is followed so.
+func (c descriptorCandidate) match(body []byte, atEOF bool) (n int, followed bool) {
+	layouts := []int{dataDescriptorLen - 4, dataDescriptor64Len - 4}
+	if c.zip64 {
+		layouts[0], layouts[1] = layouts[1], layouts[0]
 	}
-	entry.eof = true
-	b := readBuf(buf[:12])
-	if b.uint32() != entry.CRC32 {
-		return zip.ErrChecksum
+	for _, l := range layouts {
+		if len(body) < l {
+			continue
+		}
+		crc, csize, usize := parseDataDescriptor(body[:l])
+		if (c.checkCRC && crc != c.crc) || csize != c.csize || usize != c.usize {
+			continue
+		}
+		if next := body[l:]; (atEOF && len(next) == 0) || isPlausibleRecord(next) {
+			return l, true
+		}
+		if n == 0 {
+			n = l
+		}
 	}
+	return n, false
+}
 
-	// The two sizes that follow here can be either 32 bits or 64 bits
-	// but the spec is not very clear on this and different
-	// interpretations has been made causing incompatibilities. We
-	// already have the sizes from the central directory so we can
-	// just ignore these.
+// descriptorLookahead is the number of bytes needed to validate a data
+// descriptor candidate: the longest descriptor and a local file header.
+const descriptorLookahead = dataDescriptor64Len + headerIdentifierLen + fileHeaderLen
 
-	return nil
+// isPlausibleRecord reports whether buf starts with a record which may follow
+// a data descriptor, the fixed fields of a local file header must look sane.
+func isPlausibleRecord(buf []byte) bool {
+	if len(buf) < headerIdentifierLen {
+		return false
+	}
+	sig := binary.LittleEndian.Uint32(buf)
+	if sig == fileHeaderSignature {
+		return len(buf) >= headerIdentifierLen+fileHeaderLen && isFileHeader(buf)
+	}
+	return isRecordSignature(sig)
 }
 
+// parseDataDescriptor parses a data descriptor without signature, with
+// 4-byte or 8-byte sizes according to its length.
+func parseDataDescriptor(buf []byte) (crc uint32, csize, usize uint64) {
+	b := readBuf(buf)
+	crc = b.uint32()
+	if len(buf) == dataDescriptor64Len-4 {
+		return crc, b.uint64(), b.uint64()
+	}
+	return crc, uint64(b.uint32()), uint64(b.uint32())
+}
+
+// isRecordSignature reports whether sig is the signature of a record which
+// may follow a data descriptor.
+func isRecordSignature(sig uint32) bool {
+	switch sig {
+	case fileHeaderSignature, directoryHeaderSignature, directoryEndSignature,
+		directory64EndSignature, archiveExtraDataSignature:
+		return true
+	}
+	return false
+}
+
+// checksumReader owns the decompressor rc until the entry data has been read
+// to the end, a read has failed, or it has been closed by the caller while
+// the end of the entry is known without decompressing. The decompressor is
+// then closed exactly once, which returns pooled flate readers to the pool.
+// Closing an entry with data descriptor before its end keeps the
+// decompressor, it is still needed to skip the rest of the entry.
 type checksumReader struct {
-	rc    io.ReadCloser
-	hash  hash.Hash32
-	nread uint64 // number of bytes read so far
-	entry *Entry
-	err   error // sticky error
+	rc      io.ReadCloser // nil once released
+	hash    hash.Hash32
+	isCRC32 bool   // hash is CRC32, verified against Entry.CRC32
+	nread   uint64 // number of bytes read so far
+	entry   *Entry
+	err     error // sticky error
+	closed  bool  // closed by the caller
+
+	allowCorrupt bool                 // a CRC32 mismatch sets Entry.corrupt instead of failing
+	hashers      map[string]hash.Hash // see WithHashers, nil if there are none
 }
 
 func (r *checksumReader) Read(b []byte) (n int, err error) {
+	if r.closed {
+		return 0, errors.New("read after Close")
+	}
+	atomic.AddInt32(&r.entry.reading, 1)
+	defer atomic.AddInt32(&r.entry.reading, -1)
+	return r.read(b)
+}
+
+// drain reads the rest of the entry data, it also works after Close so that
+// the end of an entry with data descriptor can be found.
+func (r *checksumReader) drain() error {
+	buf := make([]byte, 32*1024)
+	for {
+		if _, err := r.read(buf); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (r *checksumReader) read(b []byte) (n int, err error) {
 	if r.err != nil {
 		return 0, r.err
 	}
 	n, err = r.rc.Read(b)
 	r.hash.Write(b[:n])
+	for _, h := range r.hashers {
+		h.Write(b[:n])
+	}
 	r.nread += uint64(n)
-	r.entry.hasReadNum += uint64(n)
 	if err == nil {
 		return
 	}
+	if isTimeout(err) {
+		// not sticky, the read can be retried, unless the decompressor
+		// retained the error, as the flate one does
+		return
+	}
+	lr, sized := r.entry.lr.(*io.LimitedReader)
+	var padding int64 // bytes left within the compressed size
+	if sized {
+		r.entry.ObservedCompressedSize = r.entry.CompressedSize64 - uint64(lr.N)
+	} else {
+		r.entry.ObservedCompressedSize = r.entry.lr.(*countReader).n
+	}
+	r.entry.ObservedUncompressedSize = r.nread
+	r.entry.checksum = r.hash.Sum32()
+	if r.isCRC32 {
+		r.entry.ObservedCRC32 = r.entry.checksum
+	}
+	if err == io.ErrUnexpectedEOF && (!sized || lr.N > 0) {
+		// the decompressor ran out of compressed data before the
+		// compressed size, if known, was read
+		err = r.entry.z.truncated(err, structEntryData)
+	} else if err != io.EOF {
+		// locate the error before the data is discarded
+		err = r.entry.entryError(r.entry.decompressError(err))
+		// The end of a sized entry is known whatever the decompressor
+		// failed on, position the stream at the next record. The end
+		// of an entry with data descriptor is only found by its
+		// decompressor, the error is fatal to the stream.
+		if sized {
+			if _, err1 := io.Copy(io.Discard, lr); err1 == nil {
+				r.entry.eof = true
+			}
+		}
+	}
 	if err == io.EOF {
-		if r.nread != r.entry.UncompressedSize64 {
-			return 0, io.ErrUnexpectedEOF
+		r.entry.computed = r.isCRC32
+		r.entry.summed = true
+		if r.hashers != nil {
+			r.entry.digests = make(map[string][]byte, len(r.hashers))
+			for name, h := range r.hashers {
+				r.entry.digests[name] = h.Sum(nil)
+			}
 		}
+		// Position the stream at the next record before any check,
+		// so that the next entry can be read whatever the outcome.
+		// The sizes and the CRC32 of an entry with data descriptor
+		// are only known once the descriptor has been read, the
+		// decompressor of a sized entry may stop short of its
+		// compressed size.
 		if r.entry.hasDataDescriptor() {
-			if err1 := readDataDescriptor(r.entry.r, r.entry); err1 != nil {
-				if err1 == io.EOF {
-					err = io.ErrUnexpectedEOF
+			err1 := readDataDescriptor(r.entry.r, r.entry, r.entry.lr.(*countReader).n, r.nread)
+			if isTimeout(err1) {
+				// not sticky, the decompressor returns io.EOF again
+				// and the descriptor is read by the next read
+				return n, err1
+			}
+			if err1 != nil {
+				err = r.entry.z.truncated(err1, structDescriptor)
+			} else if r.entry.ObservedCompressedSize != r.entry.CompressedSize64 {
+				err = sizeMismatch("compressed", r.entry.CompressedSize64, r.entry.ObservedCompressedSize)
+			}
+		} else if lr.N > 0 {
+			padding = lr.N
+			if _, err1 := io.Copy(io.Discard, lr); err1 != nil {
+				err = err1
+			}
+		}
+		r.entry.eof = true
+		if err == io.EOF {
+			// the callback runs before the sizes and the CRC32 are
+			// verified, see WithDescriptorCallback
+			r.entry.sizesKnown()
+			if sized && lr.N > 0 {
+				// the stream ended before the compressed size was read
+				err = r.entry.z.truncated(io.ErrUnexpectedEOF, structEntryData)
+			} else if r.nread != r.entry.UncompressedSize64 {
+				err = sizeMismatch("uncompressed", r.entry.UncompressedSize64, r.nread)
+			} else if r.isCRC32 && r.entry.crcKnown && r.hash.Sum32() != r.entry.CRC32 {
+				if c := r.entry.z.collector; c != nil {
+					c.ChecksumFailed()
+				}
+				if r.allowCorrupt {
+					r.entry.corrupt = true
 				} else {
-					err = err1
+					err = zip.ErrChecksum
+				}
+			} else if padding > 0 && !r.entry.z.allowPadding {
+				err = &FormatError{
+					Name:   r.entry.Name,
+					Offset: r.entry.z.offset() - padding,
+					Msg:    fmt.Sprintf("%d bytes of padding after the compressed data", padding),
 				}
-			} else if r.hash.Sum32() != r.entry.CRC32 {
-				err = zip.ErrChecksum
-			}
-		} else {
-			// If there's not a data descriptor, we still compare
-			// the CRC32 of what we've read against the file header
-			// or TOC's CRC32, if it seems like it was set.
-			r.entry.eof = true
-			if r.entry.CRC32 != 0 && r.hash.Sum32() != r.entry.CRC32 {
-				err = zip.ErrChecksum
 			}
 		}
 	}
+	if _, located := err.(*EntryError); !located && err != io.EOF {
+		err = r.entry.entryError(err)
+	}
 	r.err = err
+	r.release()
 	return
 }
 
-func (r *checksumReader) Close() error { return r.rc.Close() }
+func (r *checksumReader) Close() error {
+	r.closed = true
+	if r.err != nil || !r.entry.hasDataDescriptor() {
+		return r.release()
+	}
+	return nil
+}
+
+// release closes the decompressor.
+func (r *checksumReader) release() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// rawReader reads the compressed entry data. The data of an entry with data
+// descriptor is fed to the decompressor through a teeReader, the bytes the
+// decompressor consumed are exactly the compressed data and are handed out
+// once they have been consumed.
+type rawReader struct {
+	entry   *Entry
+	nread   uint64        // number of bytes read so far of an entry without data descriptor
+	tee     *teeReader    // nil if the entry has no data descriptor
+	fr      io.ReadCloser // decompressor reading from tee
+	scratch []byte        // decompressed output, discarded
+	usize   uint64        // number of bytes decompressed so far
+	err     error         // sticky error
+}
+
+func (r *rawReader) Read(b []byte) (int, error) {
+	atomic.AddInt32(&r.entry.reading, 1)
+	defer atomic.AddInt32(&r.entry.reading, -1)
+	if r.tee == nil {
+		if r.err != nil {
+			return 0, r.err
+		}
+		n, err := r.entry.lr.Read(b)
+		r.nread += uint64(n)
+		if isTimeout(err) {
+			return n, err // not sticky, the read can be retried
+		}
+		if err != nil {
+			r.entry.ObservedCompressedSize = r.nread
+		}
+		if err == io.EOF {
+			r.entry.eof = true
+			if r.nread != r.entry.CompressedSize64 {
+				err = r.entry.z.truncated(io.ErrUnexpectedEOF, structEntryData)
+			} else {
+				r.entry.sizesKnown()
+			}
+		}
+		if err != nil && err != io.EOF {
+			err = r.entry.entryError(err)
+		}
+		r.err = err
+		return n, err
+	}
+
+	for r.tee.buf.Len() == 0 && r.err == nil {
+		n, err := r.fr.Read(r.scratch)
+		r.usize += uint64(n)
+		if isTimeout(err) {
+			if r.tee.buf.Len() > 0 {
+				break
+			}
+			return 0, err // not sticky, the read can be retried
+		}
+		if err != nil {
+			r.entry.ObservedCompressedSize = r.tee.r.n
+			r.entry.ObservedUncompressedSize = r.usize
+		}
+		if err == io.EOF {
+			err = r.readDataDescriptor()
+			if isTimeout(err) {
+				if r.tee.buf.Len() > 0 {
+					break
+				}
+				return 0, err // not sticky, the descriptor is read again
+			}
+			r.err = err
+		} else if err != nil {
+			r.err = r.entry.decompressError(r.entry.z.truncated(err, structEntryData))
+		}
+		if r.err != nil {
+			// the decompressor is done, return it to the pool
+			r.fr.Close()
+			if r.err != io.EOF {
+				r.err = r.entry.entryError(r.err)
+			}
+		}
+	}
+	if r.tee.buf.Len() > 0 {
+		return r.tee.buf.Read(b)
+	}
+	return 0, r.err
+}
+
+// readDataDescriptor reads the data descriptor once the decompressor reached
+// the end of the entry data and validates the sizes recorded in it.
+func (r *rawReader) readDataDescriptor() error {
+	err := readDataDescriptor(r.entry.r, r.entry, r.tee.r.n, r.usize)
+	if isTimeout(err) {
+		return err
+	}
+	r.entry.eof = true
+	if err != nil {
+		return r.entry.z.truncated(err, structDescriptor)
+	}
+	r.entry.sizesKnown()
+	if r.tee.r.n != r.entry.CompressedSize64 {
+		return sizeMismatch("compressed", r.entry.CompressedSize64, r.tee.r.n)
+	}
+	if r.usize != r.entry.UncompressedSize64 {
+		return sizeMismatch("uncompressed", r.entry.UncompressedSize64, r.usize)
+	}
+	return io.EOF
+}
+
+// sizesKnown invokes the callback set by WithDescriptorCallback, once.
+func (e *Entry) sizesKnown() {
+	if e.z.onSizes != nil && !e.notified {
+		e.notified = true
+		e.z.onSizes(e)
+	}
+}
+
+// entryError wraps err in an *EntryError locating it at the current offset.
+func (e *Entry) entryError(err error) error {
+	return &EntryError{Index: e.index, Name: e.Name, Offset: e.z.offset(), Err: err}
+}
+
+// decompressError locates a corruption of the compressed data reported by the
+// decompressor in a *FormatError, other errors are wrapped with the method, the
+// name of the entry is added by entryError. Truncation errors are returned as
+// they are.
+func (e *Entry) decompressError(err error) error {
+	var ce flate.CorruptInputError
+	if errors.As(err, &ce) {
+		return &FormatError{
+			Name:   e.Name,
+			Offset: e.dataOffset + int64(ce),
+			Msg:    fmt.Sprintf("corrupt %s compressed data", MethodName(e.Method)),
+			Err:    err,
+		}
+	}
+	if errors.Is(err, ErrTruncated) {
+		return err
+	}
+	return fmt.Errorf("%s decompression failed: %w", MethodName(e.Method), err)
+}
+
+// sizeMismatch returns the error of an entry whose recorded size differs from
+// the observed one, it matches io.ErrUnexpectedEOF with errors.Is.
+func sizeMismatch(kind string, recorded, observed uint64) error {
+	return fmt.Errorf("%w: recorded %s size %d, observed %d", io.ErrUnexpectedEOF, kind, recorded, observed)
+}
+
+// teeReader retains the bytes read from r until they are read from buf.
+type teeReader struct {
+	r   *countReader
+	buf bytes.Buffer
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
+
+func (t *teeReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.buf.WriteByte(b)
+	}
+	return b, err
+}
+
+// truncated converts the EOF errors of reading a zip structure to a
+// *TruncatedError recording the current stream offset.
+func (z *Reader) truncated(err error, structure string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &TruncatedError{Offset: z.offset(), Structure: structure}
+	}
+	return err
+}
+
+// offset returns the number of bytes consumed from the stream.
+func (z *Reader) offset() int64 {
+	return z.src.n - int64(z.r.Buffered())
+}
+
+// sourceSection returns a section of the source holding the data of a STORED
+// entry without data descriptor, nil if the source can't be read at an offset
+// or the data can't be skipped by seeking, see Entry.OpenRaw.
+func (e *Entry) sourceSection() *io.SectionReader {
+	z := e.z
+	if e.Method != zip.Store || e.hasDataDescriptor() || z.manualSkip || z.src.hash != nil {
+		return nil
+	}
+	ra, ok := z.src.r.(io.ReaderAt)
+	seeker, seekable := z.src.r.(io.Seeker)
+	lr, sized := e.lr.(*io.LimitedReader)
+	if !ok || !seekable || !sized || lr.N != int64(e.CompressedSize64) {
+		return nil
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	// the source may have been partially read before the Reader was created
+	start := pos - z.src.n + e.dataOffset
+	if size := z.sourceSize(); start < 0 || size < 0 || lr.N > size-start {
+		return nil
+	}
+	return io.NewSectionReader(ra, start, lr.N)
+}
+
+// sectionReader reads the data of an entry from a section of the source,
+// invoking the callback set by WithDescriptorCallback at its end like the
+// other readers of the entry data.
+type sectionReader struct {
+	*io.SectionReader
+	entry *Entry
+}
+
+func (s *sectionReader) Read(b []byte) (int, error) {
+	n, err := s.SectionReader.Read(b)
+	if err == io.EOF {
+		s.entry.sizesKnown()
+	}
+	return n, err
+}
+
+func (s *sectionReader) ReadAt(b []byte, off int64) (int, error) {
+	n, err := s.SectionReader.ReadAt(b, off)
+	if err == io.EOF {
+		s.entry.sizesKnown()
+	}
+	return n, err
+}
+
+// seekForward discards the rest of lr, seeking the source past the bytes
+// which aren't buffered.
+func (z *Reader) seekForward(lr *io.LimitedReader) error {
+	if buffered := int64(z.r.Buffered()); lr.N <= buffered {
+		_, err := z.r.Discard(int(lr.N))
+		lr.N = 0
+		return err
+	}
+	n := lr.N - int64(z.r.Buffered())
+	if _, err := z.r.Discard(z.r.Buffered()); err != nil {
+		return err
+	}
+	if _, err := z.src.r.(io.Seeker).Seek(n, io.SeekCurrent); err != nil {
+		return err
+	}
+	z.src.n += n
+	lr.N = 0
+	return nil
+}
+
+// sourceReader counts and optionally hashes the bytes read from the source of a Reader.
+type sourceReader struct {
+	r      io.Reader
+	n      int64     // number of bytes read so far
+	hash   hash.Hash // nil if the archive is not hashed
+	closed int32     // set atomically by Reader.Close
+
+	idle    time.Duration // see WithIdleTimeout, zero if none
+	stalled bool          // a read exceeded the idle timeout
+	buf     []byte        // the buffer of the watchdog reads
+
+	collector StatsCollector // see WithStats
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&s.closed) != 0 {
+		return 0, ErrClosed
+	}
+	var n int
+	var err error
+	if s.idle > 0 {
+		n, err = s.readIdle(p)
+	} else {
+		n, err = s.r.Read(p)
+	}
+	s.n += int64(n)
+	if s.collector != nil && n > 0 {
+		s.collector.AddBytesIn(int64(n))
+	}
+	if s.hash != nil {
+		s.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// storedReader reads the data of a STORED entry with data descriptor up to
+// the descriptor, which is the first descriptor signature followed by the
+// CRC32 and the sizes of the data before it.
+type storedReader struct {
+	r       *bufio.Reader
+	hash    hash.Hash32
+	n       uint64 // number of bytes read so far
+	padding bool   // zero padding may follow the descriptor
+	eof     bool
+}
+
+func (s *storedReader) Read(p []byte) (int, error) {
+	if s.eof {
+		return 0, io.EOF
+	}
+	buf, err := s.r.Peek(s.r.Size())
+	if len(buf) == 0 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	// bytes which may start a descriptor are only handed out once the
+	// whole descriptor and the record following it can be checked
+	end := len(buf)
+	if err != io.EOF {
+		end -= descriptorLookahead - 1
+	}
+	if end <= 0 {
+		// a read error, such as a timeout, before the bytes could be
+		// checked
+		return 0, err
+	}
+	found := -1
+	for i := 0; i < end; i++ {
+		if i+4 > len(buf) || binary.LittleEndian.Uint32(buf[i:]) != dataDescriptorSignature {
+			continue
+		}
+		size := s.n + uint64(i)
+		candidate := descriptorCandidate{
+			crc:      crc32.Update(s.hash.Sum32(), crc32.IEEETable, buf[:i]),
+			checkCRC: true,
+			csize:    size,
+			usize:    size,
+		}
+		n, followed := candidate.match(buf[i+4:], err == io.EOF)
+		if n > 0 && (followed || (s.padding && len(buf) > i+4+n && buf[i+4+n] == 0)) {
+			found = i
+			end = i
+			break
+		}
+	}
+	if end > len(p) {
+		end = len(p)
+	}
+	n, _ := s.r.Read(p[:end])
+	s.hash.Write(p[:n])
+	s.n += uint64(n)
+	if n == found {
+		// the descriptor is left to readDataDescriptor
+		s.eof = true
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// limitedByteReader is an io.LimitedReader of a bufio.Reader which is also an
+// io.ByteReader, flate reads exactly the compressed data from it.
+type limitedByteReader struct {
+	*io.LimitedReader
+	r *bufio.Reader
+}
+
+func (l *limitedByteReader) ReadByte() (byte, error) {
+	if l.N <= 0 {
+		return 0, io.EOF
+	}
+	b, err := l.r.ReadByte()
+	if err == nil {
+		l.N--
+	}
+	return b, err
+}
+
+// countReader counts the bytes read from the underlying reader. It implements
+// io.ByteReader, so flate consumes exactly the compressed data and nothing
+// past the end of it.
+type countReader struct {
+	r *bufio.Reader
+	n uint64 // number of bytes read so far
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -3,11 +3,26 @@ package zipstream
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestStreamReader(t *testing.T) {
@@ -146,3 +161,3997 @@ func TestNewReader(t *testing.T) {
 	}
 
 }
+
+func TestZeroCRC32(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/crc_zero.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func(zipFile []byte) error {
+		z := NewReader(bytes.NewReader(zipFile))
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if entry.CRC32 != 0 {
+				t.Fatalf("unexpected CRC32 %08x in local header of %s", entry.CRC32, entry.Name)
+			}
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			if _, err := io.ReadAll(rc); err != nil {
+				return err
+			}
+			if entry.CRC32 != 0 {
+				t.Fatalf("unexpected CRC32 %08x of %s", entry.CRC32, entry.Name)
+			}
+			if err := rc.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := readAll(zipFile); err != nil {
+		t.Fatalf("read zip file with zero CRC32 entries fail: %s", err)
+	}
+
+	// corrupt the contents of the stored entry, whose CRC32 in the local header is zero
+	idx := bytes.Index(zipFile, []byte("CRC32 is zero"))
+	if idx < 0 {
+		t.Fatal("stored entry contents not found")
+	}
+	corrupted := append([]byte(nil), zipFile...)
+	corrupted[idx] ^= 0xff
+	if err := readAll(corrupted); !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("expected checksum error, got: %v", err)
+	}
+}
+
+func TestCentralDirEncrypted(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the central directory with an archive extra data record
+	// followed by what would be the encrypted central directory
+	zipFile := buf.Bytes()
+	idx := bytes.Index(zipFile, []byte{0x50, 0x4b, 0x01, 0x02})
+	if idx < 0 {
+		t.Fatal("central directory not found")
+	}
+	zipFile = append(zipFile[:idx:idx], 0x50, 0x4b, 0x06, 0x08, 0x04, 0x00, 0x00, 0x00, 0xde, 0xad, 0xbe, 0xef)
+
+	z := NewReader(bytes.NewReader(zipFile))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "hello.txt" {
+		t.Fatalf("unexpected entry: %s", entry.Name)
+	}
+	if _, err := z.GetNextEntry(); err != ErrCentralDirEncrypted {
+		t.Fatalf("expected ErrCentralDirEncrypted, got: %v", err)
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the central directory, got: %v", err)
+	}
+}
+
+func TestHeaderScan(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/sfx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile), WithHeaderScan(4096))
+	for _, zf := range az.File {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if entry.Name != zf.Name || entry.CRC32 != zf.CRC32 {
+			t.Fatalf("expected entry %s, got %s", zf.Name, entry.Name)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if z.PrefixLength() != 2006 {
+		t.Fatalf("unexpected prefix length: %d", z.PrefixLength())
+	}
+
+	if _, err := NewReader(bytes.NewReader(zipFile), WithHeaderScan(1024)).GetNextEntry(); err != ErrPrefixTooLong {
+		t.Fatalf("expected ErrPrefixTooLong, got: %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry(); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat without header scan, got: %v", err)
+	}
+}
+
+func TestOpenString(t *testing.T) {
+	f, err := os.Open("testdata/sfx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	z := NewReader(f, WithHeaderScan(4096))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "hello.txt" {
+		t.Fatalf("unexpected entry: %s", entry.Name)
+	}
+	content, err := entry.OpenString()
+	if err != nil {
+		t.Fatalf("read entry as string fail: %s", err)
+	}
+	if content != "hello from a self-extracting archive\n" {
+		t.Fatalf("unexpected entry contents: %q", content)
+	}
+}
+
+func TestEmptyArchive(t *testing.T) {
+	var buf bytes.Buffer
+	if err := zip.NewWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(buf.Bytes())).GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF for an empty archive, got: %v", err)
+	}
+
+	// an empty archive is a lone end of central directory record
+	emptyZip, err := os.ReadFile("testdata/empty.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := NewReader(bytes.NewReader(emptyZip))
+	if z.IsEmpty() {
+		t.Fatal("the archive is not known to be empty before the iteration")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("expected io.EOF for an empty archive, got: %v", err)
+		}
+	}
+	if !z.IsEmpty() || !z.SawCentralDirectory() {
+		t.Fatal("the archive is empty")
+	}
+
+	z = NewReader(bytes.NewReader(buildZip(t, func(zw *zip.Writer) error {
+		_, err := zw.Create("a.txt")
+		return err
+	})))
+	for {
+		if _, err := z.GetNextEntry(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if z.IsEmpty() {
+		t.Fatal("the archive is not empty")
+	}
+	if _, err := NewReader(bytes.NewReader(nil)).GetNextEntry(); err != ErrEmptyStream {
+		t.Fatalf("expected ErrEmptyStream for an empty stream, got: %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()[:2])).GetNextEntry(); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated for a truncated signature, got: %v", err)
+	}
+}
+
+// buildZip returns the archive written by fn with a zip.Writer.
+func buildZip(t *testing.T, fn func(zw *zip.Writer) error) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := fn(zw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenRawDescriptorCRC(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i, content := range []string{"hello world", strings.Repeat("0123456789", 10000), ""} {
+			w, err := zw.Create(fmt.Sprintf("file%d.txt", i))
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(content)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for _, zf := range az.File {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		r, err := entry.OpenRaw()
+		if err != nil {
+			t.Fatalf("open raw entry fail: %s", err)
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read raw entry fail: %s", err)
+		}
+
+		zr, err := zf.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, expected) {
+			t.Fatalf("the raw contents of %s are incorrect", entry.Name)
+		}
+		if entry.DescriptorCRC() != zf.CRC32 {
+			t.Fatalf("expected descriptor CRC32 %08x of %s, got %08x", zf.CRC32, entry.Name, entry.DescriptorCRC())
+		}
+		if entry.CompressedSize64 != zf.CompressedSize64 || entry.UncompressedSize64 != zf.UncompressedSize64 {
+			t.Fatalf("the sizes of %s are incorrect", entry.Name)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	content := []byte(strings.Repeat("hello world\n", 100))
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "stored.txt",
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+		if w, err = zw.Create("deflated.txt"); err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	})
+
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedData, err := az.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedEnd := storedData + int64(az.File[0].CompressedSize64)
+	deflatedData, err := az.File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deflatedEnd := deflatedData + int64(az.File[1].CompressedSize64)
+	centralDir := deflatedEnd + dataDescriptorLen
+
+	readAll := func(r io.Reader) error {
+		z := NewReader(r)
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			if _, err := io.ReadAll(rc); err != nil {
+				return err
+			}
+		}
+	}
+
+	tests := []struct {
+		offset    int64
+		structure string
+	}{
+		{2, structSignature},
+		{10, structFileHeader},
+		{storedData - 3, structNameExtra},
+		{storedData + 3, structEntryData},
+		{storedEnd, structCentralDir},
+		{storedEnd + 2, structSignature},
+		{storedEnd + 20, structFileHeader},
+		{deflatedData + 5, structEntryData},
+		{deflatedEnd, structDescriptor},
+		{deflatedEnd + 7, structDescriptor},
+		{centralDir, structCentralDir},
+		{centralDir + 3, structSignature},
+	}
+	for _, tt := range tests {
+		err := readAll(bytes.NewReader(zipFile[:tt.offset]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("expected ErrTruncated at offset %d, got: %v", tt.offset, err)
+		}
+		var te *TruncatedError
+		if !errors.As(err, &te) {
+			t.Fatalf("expected *TruncatedError at offset %d, got: %v", tt.offset, err)
+		}
+		if te.Offset != tt.offset || te.Structure != tt.structure {
+			t.Fatalf("expected truncation of %s at offset %d, got: %v", tt.structure, tt.offset, te)
+		}
+	}
+
+	if err := readAll(bytes.NewReader(zipFile)); err != nil {
+		t.Fatalf("read the complete archive fail: %s", err)
+	}
+}
+
+func TestExpectEntries(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	readAll := func(expect int) error {
+		z := NewReader(bytes.NewReader(zipFile))
+		z.ExpectEntries(expect)
+		for {
+			if _, err := z.GetNextEntry(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := readAll(2); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if err := readAll(3); !errors.Is(err, ErrIncompleteArchive) {
+		t.Fatalf("expected ErrIncompleteArchive, got: %v", err)
+	}
+
+	// a download stopped after the second of three entries
+	truncated, err := os.ReadFile("testdata/truncated.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []int{2, 3} {
+		z := NewReader(bytes.NewReader(truncated), WithAllowMissingDirectory())
+		z.ExpectEntries(expect)
+		n := 0
+		for {
+			if _, err = z.GetNextEntry(); err != nil {
+				break
+			}
+			n++
+		}
+		if n != 2 {
+			t.Fatalf("expected 2 entries, got %d", n)
+		}
+		if expect == 2 && err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+		if expect == 3 && !errors.Is(err, ErrIncompleteArchive) {
+			t.Fatalf("expected ErrIncompleteArchive, got: %v", err)
+		}
+	}
+}
+
+func TestAllowMissingDirectory(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/crc_zero.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataOffset, err := az.File[1].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	centralDir := dataOffset + int64(az.File[1].CompressedSize64) + dataDescriptorLen
+
+	readAll := func(zipFile []byte) (*Reader, error) {
+		z := NewReader(bytes.NewReader(zipFile), WithAllowMissingDirectory())
+		for {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				return z, err
+			}
+			if _, err := entry.Bytes(); err != nil {
+				return z, err
+			}
+		}
+	}
+
+	z, err := readAll(zipFile[:centralDir])
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if z.SawCentralDirectory() {
+		t.Fatal("central directory is reported without being read")
+	}
+
+	if z, err = readAll(zipFile); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if !z.SawCentralDirectory() {
+		t.Fatal("central directory is not reported")
+	}
+
+	if _, err := readAll(zipFile[:centralDir-1]); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got: %v", err)
+	}
+}
+
+func TestArchiveHash(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256(zipFile)
+
+	z := NewReader(bytes.NewReader(zipFile), WithArchiveHash(sha256.New))
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if entry.Name == "zipiterator/reader.go" {
+			if _, err := entry.Bytes(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if sum := z.ArchiveHashSum(); !bytes.Equal(sum, expected[:]) {
+		t.Fatalf("expected archive hash %x, got %x", expected, sum)
+	}
+}
+
+func TestStripAlignmentExtras(t *testing.T) {
+	extTime := []byte{0x55, 0x54, 0x05, 0x00, 0x01, 0x00, 0xe0, 0xd9, 0x63}
+	extra := append([]byte{0xfe, 0xca, 0x00, 0x00}, extTime...)
+	extra = append(extra, 0x35, 0xd9, 0x06, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00)
+	extra = append(extra, 0x00, 0x00, 0x00, 0x00)
+
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "META-INF/MANIFEST.MF",
+			Method:             zip.Store,
+			Extra:              extra,
+			CRC32:              crc32.ChecksumIEEE([]byte("Manifest-Version: 1.0\n")),
+			CompressedSize64:   22,
+			UncompressedSize64: 22,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("Manifest-Version: 1.0\n"))
+		return err
+	})
+
+	for _, strip := range []bool{false, true} {
+		z := NewReader(bytes.NewReader(zipFile))
+		z.SetStripAlignmentExtras(strip)
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := extra
+		if strip {
+			expected = extTime
+		}
+		if !bytes.Equal(entry.Extra, expected) {
+			t.Fatalf("expected extra % x, got % x", expected, entry.Extra)
+		}
+		if content, err := entry.OpenString(); err != nil || content != "Manifest-Version: 1.0\n" {
+			t.Fatalf("read entry contents fail: %v", err)
+		}
+	}
+}
+
+func TestSpanningMarker(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	spanned := append([]byte("PK00"), zipFile...)
+
+	for _, opts := range [][]Option{nil, {WithHeaderScan(1024)}} {
+		z := NewReader(bytes.NewReader(spanned), opts...)
+		for _, name := range []string{"a.txt", "b.txt"} {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatalf("unable to get next entry: %s", err)
+			}
+			if content, err := entry.OpenString(); err != nil || content != name {
+				t.Fatalf("read entry %s fail: %v", entry.Name, err)
+			}
+		}
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+		if z.PrefixLength() != 0 {
+			t.Fatalf("the spanning marker is counted as prefix: %d", z.PrefixLength())
+		}
+	}
+
+	// the marker is not accepted after the first entry
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataOffset, err := az.File[0].DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryEnd := dataOffset + int64(az.File[0].CompressedSize64) + dataDescriptorLen
+	corrupted := append(append(append([]byte(nil), zipFile[:entryEnd]...), "PK00"...), zipFile[entryEnd:]...)
+	z := NewReader(bytes.NewReader(corrupted))
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat, got: %v", err)
+	}
+}
+
+func TestCopyRawN(t *testing.T) {
+	content := []byte(strings.Repeat("hello world\n", 100))
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "stored.txt",
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+		if w, err = zw.Create("deflated.txt"); err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if n, err := entry.CopyRawN(&buf, 100); err != nil || n != 100 {
+		t.Fatalf("expected 100 bytes copied, got %d: %v", n, err)
+	}
+	if n, err := entry.CopyRawN(&buf, 10000); err != nil || n != int64(len(content))-100 {
+		t.Fatalf("expected %d bytes copied, got %d: %v", len(content)-100, n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Fatal("the copied raw contents are incorrect")
+	}
+
+	entry, err = z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.CopyRawN(&buf, 100); err != ErrUnknownSize {
+		t.Fatalf("expected ErrUnknownSize, got: %v", err)
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestInterEntryPadding(t *testing.T) {
+	contents := []string{"classes.dex", "resources.arsc"}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, content := range contents {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               content,
+				Method:             zip.Store,
+				Extra:              []byte{0x35, 0xd9, 0x06, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00},
+				CRC32:              crc32.ChecksumIEEE([]byte(content)),
+				CompressedSize64:   uint64(len(content)),
+				UncompressedSize64: uint64(len(content)),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(content)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// pad the first entry data to a 64 bytes boundary
+	entryEnd := 30 + len(contents[0]) + 10 + len(contents[0])
+	padding := make([]byte, 64-entryEnd)
+	padded := append(append(append([]byte(nil), zipFile[:entryEnd]...), padding...), zipFile[entryEnd:]...)
+
+	readAll := func(opts ...Option) error {
+		z := NewReader(bytes.NewReader(padded), opts...)
+		for _, content := range contents {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				return err
+			}
+			if s, err := entry.OpenString(); err != nil || s != content {
+				t.Fatalf("read entry %s fail: %v", entry.Name, err)
+			}
+		}
+		_, err := z.GetNextEntry()
+		return err
+	}
+
+	if err := readAll(WithInterEntryPadding(64)); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if err := readAll(WithInterEntryPadding(len(padding) - 1)); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat when the padding exceeds the limit, got: %v", err)
+	}
+	if err := readAll(); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat without padding option, got: %v", err)
+	}
+}
+
+func TestStrictExtraField(t *testing.T) {
+	// the extended timestamp field declares 9 bytes but only 5 follow
+	extra := []byte{0x55, 0x54, 0x09, 0x00, 0x01, 0x00, 0xe0, 0xd9, 0x63}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "a.txt",
+			Method:             zip.Store,
+			Extra:              extra,
+			CRC32:              crc32.ChecksumIEEE([]byte("a")),
+			CompressedSize64:   1,
+			UncompressedSize64: 1,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("a"))
+		return err
+	})
+
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatalf("a truncated extra field is not tolerated: %s", err)
+	}
+	if !bytes.Equal(entry.Extra, extra) {
+		t.Fatal("the extra field is incorrect")
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	z.SetStrict(true)
+	_, err = z.GetNextEntry()
+	var fe *FormatError
+	if !errors.As(err, &fe) || !errors.Is(err, zip.ErrFormat) {
+		t.Fatalf("expected *FormatError, got: %v", err)
+	}
+	if fe.Name != "a.txt" || fe.Offset != 30+5 {
+		t.Fatalf("unexpected format error: %v", fe)
+	}
+}
+
+func TestSigningBlock(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"AndroidManifest.xml", "classes.dex"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// a signing block with a single ID-value pair
+	pair := []byte{0x0c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1a, 0x87, 0x09, 0x71, 0xde, 0xad, 0xbe, 0xef}
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(pair)+8+16))
+	block := append(append(append(append([]byte(nil), size...), pair...), size...), "APK Sig Block 42"...)
+
+	centralDir := bytes.Index(zipFile, []byte{0x50, 0x4b, 0x01, 0x02})
+	apk := append(append(append([]byte(nil), zipFile[:centralDir]...), block...), zipFile[centralDir:]...)
+
+	z := NewReader(bytes.NewReader(apk), WithSigningBlocks())
+	for i := 0; ; i++ {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			if i != 2 {
+				t.Fatalf("expected 2 entries, got %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if _, err := entry.Bytes(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !z.SawCentralDirectory() {
+		t.Fatal("central directory is not reported")
+	}
+	if blocks := z.TrailingBlocks(); len(blocks) != 1 || !bytes.Equal(blocks[0], block) {
+		t.Fatal("the signing block is not returned")
+	}
+
+	// a block without the magic is not skipped
+	corrupted := append([]byte(nil), apk...)
+	corrupted[centralDir+len(block)-1] = '3'
+	z = NewReader(bytes.NewReader(corrupted), WithSigningBlocks())
+	for {
+		if _, err := z.GetNextEntry(); err != nil {
+			if err != zip.ErrFormat {
+				t.Fatalf("expected zip.ErrFormat, got: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestSigningBlockNotRead(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("classes.dex")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("dex"))
+		return err
+	})
+
+	// a block declaring the largest size, never buffered without WithSigningBlocks
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, maxSigningBlockSize)
+	centralDir := bytes.Index(zipFile, []byte{0x50, 0x4b, 0x01, 0x02})
+	apk := append(append(append([]byte(nil), zipFile[:centralDir]...), size...), zipFile[centralDir:]...)
+
+	z := NewReader(bytes.NewReader(apk))
+	z.SetTolerateUnknownTrailer(true)
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if len(z.TrailingBlocks()) != 0 {
+		t.Fatal("unexpected trailing blocks")
+	}
+
+	z = NewReader(bytes.NewReader(apk))
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat, got: %v", err)
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i := 0; i < 50; i++ {
+			w, err := zw.Create(fmt.Sprintf("file%d.txt", i))
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(strings.Repeat(fmt.Sprintf("line %d\n", i), i*100))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		raw := i%2 == 1
+		go func() {
+			z := NewReader(bytes.NewReader(zipFile))
+			for {
+				entry, err := z.GetNextEntry()
+				if err == io.EOF {
+					errs <- nil
+					return
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				var r io.Reader
+				if raw {
+					r, err = entry.OpenRaw()
+				} else {
+					r, err = entry.Open()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					errs <- fmt.Errorf("read %s fail: %w", entry.Name, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIsDeflate64(t *testing.T) {
+	tests := []struct {
+		method        uint16
+		flags         uint16
+		readerVersion uint16
+		deflate64     bool
+	}{
+		{CompressMethodDeflate64, 0, 21, true},
+		{CompressMethodDeflate64, 0, 20, true},
+		{CompressMethodDeflated, 0x10, 21, true},
+		{CompressMethodDeflated, 0x10, 45, true},
+		{CompressMethodDeflated, 0x10, 20, false},
+		{CompressMethodDeflated, 0, 21, false},
+		{CompressMethodDeflated, 0x08, 21, false},
+		{CompressMethodStored, 0x10, 21, false},
+	}
+	for _, tt := range tests {
+		entry := &Entry{FileHeader: zip.FileHeader{Method: tt.method, Flags: tt.flags, ReaderVersion: tt.readerVersion}}
+		if entry.IsDeflate64() != tt.deflate64 {
+			t.Fatalf("method %d, flags 0x%04x, version %d: expected IsDeflate64 %v", tt.method, tt.flags, tt.readerVersion, tt.deflate64)
+		}
+	}
+}
+
+// rawFileHeader returns the local file header of fh, including the signature.
+func rawFileHeader(fh *zip.FileHeader) []byte {
+	var buf bytes.Buffer
+	for _, v := range []interface{}{
+		uint32(fileHeaderSignature), fh.ReaderVersion, fh.Flags, fh.Method, fh.ModifiedTime, fh.ModifiedDate,
+		fh.CRC32, fh.CompressedSize, fh.UncompressedSize, uint16(len(fh.Name)), uint16(len(fh.Extra)),
+	} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString(fh.Name)
+	buf.Write(fh.Extra)
+	return buf.Bytes()
+}
+
+func TestBytesSizeTooLarge(t *testing.T) {
+	extra := make([]byte, 20)
+	binary.LittleEndian.PutUint16(extra, Zip64ExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 16)
+	binary.LittleEndian.PutUint64(extra[4:], 1<<63+1) // uncompressed size
+	binary.LittleEndian.PutUint64(extra[12:], 10)     // compressed size
+	header := rawFileHeader(&zip.FileHeader{
+		Name:             "huge.bin",
+		ReaderVersion:    45,
+		CompressedSize:   ^uint32(0),
+		UncompressedSize: ^uint32(0),
+		Extra:            extra,
+	})
+
+	entry, err := NewReader(bytes.NewReader(append(header, make([]byte, 10)...))).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.UncompressedSize64 != 1<<63+1 {
+		t.Fatalf("unexpected uncompressed size: %d", entry.UncompressedSize64)
+	}
+	if _, err := entry.Bytes(); err != ErrSizeTooLargeForPlatform {
+		t.Fatalf("expected ErrSizeTooLargeForPlatform, got: %v", err)
+	}
+}
+
+func TestBytesDeclaredSize(t *testing.T) {
+	// a stored entry declaring 512 MiB but holding 10 bytes
+	header := rawFileHeader(&zip.FileHeader{
+		Name:             "lying.bin",
+		ReaderVersion:    20,
+		ModifiedDate:     0x5021,
+		CompressedSize:   10,
+		UncompressedSize: 512 << 20,
+	})
+	entry, err := NewReader(bytes.NewReader(append(header, make([]byte, 10)...))).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := entry.Bytes(); err == nil {
+		t.Fatal("expected the size mismatch to fail")
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Fatalf("the declared size is preallocated: %d bytes allocated", alloc)
+	}
+}
+
+func TestStats(t *testing.T) {
+	f, err := os.Open("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	z := NewReader(f)
+	for {
+		if _, err := z.GetNextEntry(); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	stats := z.Stats()
+	if stats.Entries != 58 || stats.WithoutDataDescriptor != 58 || stats.WithDataDescriptor != 0 || stats.Zip64 != 0 {
+		t.Fatalf("unexpected entry counts: %+v", stats)
+	}
+	if len(stats.Methods) != 2 || stats.Methods[zip.Store] != 24 || stats.Methods[zip.Deflate] != 34 {
+		t.Fatalf("unexpected method counts: %v", stats.Methods)
+	}
+
+	z = NewReader(bytes.NewReader(buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt", "dir/"} {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})))
+	for {
+		if _, err := z.GetNextEntry(); err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	stats = z.Stats()
+	if stats.Entries != 3 || stats.WithDataDescriptor != 2 || stats.WithoutDataDescriptor != 1 ||
+		stats.DescriptorsWithSignature != 2 || stats.DescriptorsWithoutSignature != 0 {
+		t.Fatalf("unexpected entry counts: %+v", stats)
+	}
+}
+
+func TestEarlyClose(t *testing.T) {
+	const entries = 2100
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i := 0; i < entries; i++ {
+			name := fmt.Sprintf("file%d.txt", i)
+			contents := []byte(strings.Repeat(fmt.Sprintf("line %d\n", i), i%50*100))
+			// the odd entries record their sizes in the local header
+			var w io.Writer
+			var err error
+			if i%2 == 0 {
+				w, err = zw.Create(name)
+			} else {
+				compressed := deflate(t, contents)
+				w, err = zw.CreateRaw(&zip.FileHeader{
+					Name:               name,
+					Method:             zip.Deflate,
+					ModifiedDate:       0x5021,
+					CRC32:              crc32.ChecksumIEEE(contents),
+					CompressedSize64:   uint64(len(compressed)),
+					UncompressedSize64: uint64(len(contents)),
+				})
+				contents = compressed
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	outstanding := atomic.LoadInt64(&outstandingFlateReaders)
+	z := NewReader(bytes.NewReader(zipFile))
+	var partial io.Reader // the reader of the previous entry, partly read
+	for i := 0; ; i++ {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			if i != entries {
+				t.Fatalf("expected %d entries, got %d", entries, i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to get entry %d: %s", i, err)
+		}
+
+		buf := make([]byte, 10)
+		if partial != nil {
+			// the previous entry has been skipped
+			if n, err := partial.Read(buf); n != 0 || err == nil {
+				t.Fatalf("entry %d: read after skip returned %d bytes, %v", i-1, n, err)
+			}
+			partial = nil
+		}
+		switch i % 7 {
+		case 0:
+			// not opened
+		case 1:
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			if err != nil || uint64(len(content)) != entry.UncompressedSize64 {
+				t.Fatalf("read %s fail: %v", entry.Name, err)
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatal(err)
+			}
+		case 2:
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rc.Read(buf)
+			if err := rc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rc.Read(buf); err == nil {
+				t.Fatal("read after Close succeeded")
+			}
+		case 3:
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rc.Read(buf)
+			partial = rc
+		case 4:
+			r, err := entry.OpenRaw()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = r.Read(buf)
+		case 5:
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rc.Read(buf)
+			if err := entry.Skip(); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := entry.Read(buf); n != 0 || err == nil {
+				t.Fatalf("%s: read after Skip returned %d bytes, %v", entry.Name, n, err)
+			}
+		case 6:
+			if err := entry.Skip(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// every flate reader taken from the pool was returned
+	if n := atomic.LoadInt64(&outstandingFlateReaders); n != outstanding {
+		t.Fatalf("expected %d outstanding flate readers, got %d", outstanding, n)
+	}
+}
+
+func TestFlateReadersReturnedOnError(t *testing.T) {
+	outstanding := atomic.LoadInt64(&outstandingFlateReaders)
+
+	// corrupt compressed data, with the sizes in the local header
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"corrupt.txt", "next.txt"} {
+			data := bytes.Repeat([]byte{0xff}, 100)
+			if name == "next.txt" {
+				data = deflate(t, []byte("next"))
+			}
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               name,
+				Method:             zip.Deflate,
+				ModifiedDate:       0x5021,
+				CompressedSize64:   uint64(len(data)),
+				UncompressedSize64: 4,
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	z := NewReader(bytes.NewReader(zipFile))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); err == nil {
+		t.Fatal("expected an error reading corrupt data")
+	}
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a CRC32 mismatch
+	zipFile, err = os.ReadFile("testdata/badcrc.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err = NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("expected zip.ErrChecksum, got: %v", err)
+	}
+
+	if n := atomic.LoadInt64(&outstandingFlateReaders); n != outstanding {
+		t.Fatalf("expected %d outstanding flate readers, got %d", outstanding, n)
+	}
+}
+
+func BenchmarkOpenRaw(b *testing.B) {
+	benchmarkOpenRaw(b)
+}
+
+func BenchmarkOpenRawBufferSize(b *testing.B) {
+	for _, size := range []int{4 << 10, 32 << 10, 256 << 10} {
+		b.Run(fmt.Sprintf("%dK", size>>10), func(b *testing.B) {
+			benchmarkOpenRaw(b, WithRawBufferSize(size))
+		})
+	}
+}
+
+func benchmarkOpenRaw(b *testing.B, opts ...Option) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < 10; i++ {
+		w, err := zw.Create(fmt.Sprintf("file%d.txt", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write([]byte(strings.Repeat(fmt.Sprintf("line %d\n", i), 100000))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		b.Fatal(err)
+	}
+	zipFile := buf.Bytes()
+
+	b.SetBytes(int64(len(zipFile)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		z := NewReader(bytes.NewReader(zipFile), opts...)
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			r, err := entry.OpenRaw()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// buildStoredZip returns an archive of n STORED entries of size bytes each.
+func buildStoredZip(tb testing.TB, n, size int) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < n; i++ {
+		contents := []byte(strings.Repeat(string(rune('a'+i)), size))
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               fmt.Sprintf("file%d.txt", i),
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(contents),
+			CompressedSize64:   uint64(size),
+			UncompressedSize64: uint64(size),
+		})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenRawSectionCallback(t *testing.T) {
+	zipFile := buildStoredZip(t, 2, 1000)
+	calls := map[string]int{}
+	z := NewReader(bytes.NewReader(zipFile), WithDescriptorCallback(func(e *Entry) {
+		calls[e.Name]++
+	}))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := entry.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.(io.ReaderAt); !ok {
+		t.Fatalf("expected a section of the source, got %T", r)
+	}
+	buf := make([]byte, 600)
+	for {
+		_, err := r.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls[entry.Name] != 0 {
+			t.Fatal("the callback is invoked before the end of the data")
+		}
+	}
+	// invoked before io.EOF is returned
+	if calls[entry.Name] != 1 {
+		t.Fatalf("expected the callback once, got %d calls", calls[entry.Name])
+	}
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if calls[entry.Name] != 1 {
+		t.Fatalf("expected the callback once, got %d calls", calls[entry.Name])
+	}
+}
+
+func TestOpenRawSection(t *testing.T) {
+	zipFile := buildStoredZip(t, 3, 100000)
+
+	// the source was partially read, its offsets are shifted
+	prefixed := bytes.NewReader(append([]byte("prefix"), zipFile...))
+	if _, err := prefixed.Seek(int64(len("prefix")), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		src     io.Reader
+		section bool
+	}{
+		{"seekable", bytes.NewReader(zipFile), true},
+		{"partially read", prefixed, true},
+		{"not seekable", struct{ io.Reader }{bytes.NewReader(zipFile)}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			z := NewReader(test.src)
+			for i := 0; ; i++ {
+				entry, err := z.GetNextEntry()
+				if err == io.EOF {
+					if i != 3 {
+						t.Fatalf("expected 3 entries, got %d", i)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 1 {
+					continue // skipped without being opened
+				}
+				r, err := entry.OpenRaw()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := r.(io.ReaderAt); ok != test.section {
+					t.Fatalf("expected a section of the source %v, got %T", test.section, r)
+				}
+				// the first entry is only partially read
+				limit := int64(100000)
+				if i == 0 {
+					limit = 10
+				}
+				data, err := io.ReadAll(io.LimitReader(r, limit))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected := strings.Repeat(string(rune('a'+i)), int(limit)); string(data) != expected {
+					t.Fatalf("%s: unexpected data %.20q", entry.Name, data)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkOpenRawStored(b *testing.B) {
+	zipFile := buildStoredZip(b, 4, 1<<20)
+	for _, test := range []struct {
+		name string
+		src  func() io.Reader
+	}{
+		{"seekable", func() io.Reader { return bytes.NewReader(zipFile) }},
+		{"stream", func() io.Reader { return struct{ io.Reader }{bytes.NewReader(zipFile)} }},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.SetBytes(int64(len(zipFile)))
+			for i := 0; i < b.N; i++ {
+				z := NewReader(test.src())
+				for {
+					entry, err := z.GetNextEntry()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					r, err := entry.OpenRaw()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := io.Copy(io.Discard, r); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestModifiedTimePriority(t *testing.T) {
+	ntfsTime := time.Date(2023, time.February, 1, 10, 0, 0, 123456700, time.UTC)
+	unixTime := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	extTime := time.Date(2021, time.April, 5, 6, 7, 8, 0, time.UTC)
+
+	ntfs := make([]byte, 36)
+	binary.LittleEndian.PutUint16(ntfs, NtfsExtraID)
+	binary.LittleEndian.PutUint16(ntfs[2:], 32)
+	binary.LittleEndian.PutUint16(ntfs[8:], 1)   // attribute tag
+	binary.LittleEndian.PutUint16(ntfs[10:], 24) // attribute size
+	epoch := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+	binary.LittleEndian.PutUint64(ntfs[12:], uint64((ntfsTime.Unix()-epoch.Unix())*1e7+int64(ntfsTime.Nanosecond()/100)))
+
+	unix := make([]byte, 12)
+	binary.LittleEndian.PutUint16(unix, InfoZipUnixExtraID)
+	binary.LittleEndian.PutUint16(unix[2:], 8)
+	binary.LittleEndian.PutUint32(unix[8:], uint32(unixTime.Unix()))
+
+	ext := make([]byte, 9)
+	binary.LittleEndian.PutUint16(ext, ExtTimeExtraID)
+	binary.LittleEndian.PutUint16(ext[2:], 5)
+	ext[4] = 1
+	binary.LittleEndian.PutUint32(ext[5:], uint32(extTime.Unix()))
+
+	tests := []struct {
+		extra    []byte
+		modified time.Time
+	}{
+		{append(append(append([]byte(nil), ntfs...), unix...), ext...), ntfsTime},
+		{append(append(append([]byte(nil), unix...), ext...), ntfs...), ntfsTime},
+		{append(append([]byte(nil), unix...), ext...), extTime},
+		{append(append([]byte(nil), ext...), unix...), extTime},
+		{unix, unixTime},
+	}
+	for _, tt := range tests {
+		header := rawFileHeader(&zip.FileHeader{Name: "a.txt", Extra: tt.extra})
+		entry, err := NewReader(bytes.NewReader(header)).GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !entry.Modified.Equal(tt.modified) {
+			t.Fatalf("expected modified time %s, got %s", tt.modified, entry.Modified)
+		}
+	}
+}
+
+// deflate returns the raw deflate stream of content.
+func deflate(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCorruptSizesKeepStreamPosition(t *testing.T) {
+	content := []byte(strings.Repeat("hello world\n", 100))
+	compressed := deflate(t, content)
+	padding := make([]byte, 8192) // more than flate reads ahead
+
+	tests := []struct {
+		name string
+		fh   zip.FileHeader
+		data []byte
+	}{
+		{
+			// the header claims more compressed data than the deflate stream
+			name: "sized.txt",
+			fh: zip.FileHeader{
+				Method:             zip.Deflate,
+				CRC32:              crc32.ChecksumIEEE(content),
+				CompressedSize64:   uint64(len(compressed) + len(padding)),
+				UncompressedSize64: uint64(len(content) + 1),
+			},
+			data: append(append([]byte(nil), compressed...), padding...),
+		},
+		{
+			// the data descriptor claims a wrong uncompressed size
+			name: "descriptor.txt",
+			fh: zip.FileHeader{
+				Method:             zip.Deflate,
+				Flags:              0x8,
+				CRC32:              crc32.ChecksumIEEE(content),
+				CompressedSize64:   uint64(len(compressed)),
+				UncompressedSize64: uint64(len(content) - 1),
+			},
+			data: compressed,
+		},
+	}
+	for _, tt := range tests {
+		zipFile := buildZip(t, func(zw *zip.Writer) error {
+			fh := tt.fh
+			fh.Name = tt.name
+			w, err := zw.CreateRaw(&fh)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(tt.data); err != nil {
+				return err
+			}
+			if w, err = zw.Create("next.txt"); err != nil {
+				return err
+			}
+			_, err = w.Write([]byte("next"))
+			return err
+		})
+
+		z := NewReader(bytes.NewReader(zipFile))
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Bytes(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("%s: expected io.ErrUnexpectedEOF, got: %v", tt.name, err)
+		}
+		if entry, err = z.GetNextEntry(); err != nil {
+			t.Fatalf("%s: unable to get the following entry: %s", tt.name, err)
+		}
+		if s, err := entry.OpenString(); err != nil || s != "next" {
+			t.Fatalf("%s: read the following entry fail: %v", tt.name, err)
+		}
+	}
+}
+
+func TestHeaderError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		strict bool
+		field  string
+	}{
+		{
+			name:   "empty name",
+			header: rawFileHeader(&zip.FileHeader{ReaderVersion: 20}),
+			strict: true,
+			field:  "file name length",
+		},
+		{
+			name:   "name past the end",
+			header: rawFileHeader(&zip.FileHeader{Name: "abcdef", ReaderVersion: 20})[:fileHeaderLen+headerIdentifierLen+3],
+			field:  "file name length",
+		},
+		{
+			name:   "reader version",
+			header: rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 99}),
+			strict: true,
+			field:  "version needed to extract",
+		},
+		{
+			name:   "compressed size without zip64",
+			header: rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 20, CompressedSize: ^uint32(0)}),
+			field:  "compressed size",
+		},
+		{
+			name:   "uncompressed size without zip64",
+			header: rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 20, UncompressedSize: ^uint32(0)}),
+			strict: true,
+			field:  "uncompressed size",
+		},
+		{
+			name:   "directory with content",
+			header: rawFileHeader(&zip.FileHeader{Name: "dir/", ReaderVersion: 20, UncompressedSize: 3}),
+			strict: true,
+			field:  "uncompressed size of directory",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prefix := rawFileHeader(&zip.FileHeader{Name: "first.txt", ReaderVersion: 20})
+			z := NewReader(bytes.NewReader(append(prefix, tc.header...)))
+			z.SetStrict(tc.strict)
+			if _, err := z.GetNextEntry(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := z.GetNextEntry()
+			var he *HeaderError
+			if !errors.As(err, &he) || !errors.Is(err, zip.ErrFormat) {
+				t.Fatalf("expected *HeaderError, got: %v", err)
+			}
+			if he.Field != tc.field || he.Index != 1 || he.Offset != int64(len(prefix)) {
+				t.Fatalf("unexpected header error: %v", he)
+			}
+		})
+	}
+}
+
+func TestHeaderWarnings(t *testing.T) {
+	// outside strict mode, the fields rejected in strict mode are warnings
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		code   WarningCode
+	}{
+		{"empty name", rawFileHeader(&zip.FileHeader{ReaderVersion: 20, ModifiedDate: 0x5021}), WarnEmptyName},
+		{"reader version", rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 99, ModifiedDate: 0x5021}), WarnReaderVersion},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			next := rawFileHeader(&zip.FileHeader{Name: "next.txt", ReaderVersion: 20, ModifiedDate: 0x5021})
+			z := NewReader(bytes.NewReader(append(tc.header, next...)))
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w := entry.Warnings(); len(w) != 1 || w[0].Code != tc.code || w[0].Offset == 0 {
+				t.Fatalf("expected a %s warning, got %v", tc.code, w)
+			}
+			if entry, err = z.GetNextEntry(); err != nil || entry.Name != "next.txt" {
+				t.Fatalf("unable to read the following entry: %v", err)
+			}
+		})
+	}
+}
+
+func TestAllowTrailingPadding(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/padding.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, allow := range []bool{false, true} {
+		z := NewReader(bytes.NewReader(zipFile))
+		z.SetAllowTrailingPadding(allow)
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := entry.OpenString()
+		if allow {
+			if err != nil || s != strings.Repeat("padded entry\n", 20) {
+				t.Fatalf("read padded entry fail: %v", err)
+			}
+		} else {
+			var fe *FormatError
+			if !errors.As(err, &fe) || fe.Name != "padded.txt" {
+				t.Fatalf("expected *FormatError, got: %v", err)
+			}
+		}
+		if entry, err = z.GetNextEntry(); err != nil {
+			t.Fatalf("unable to get the following entry: %s", err)
+		}
+		if s, err := entry.OpenString(); err != nil || s != "next\n" {
+			t.Fatalf("read the following entry fail: %v", err)
+		}
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/exotic.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	var names []string
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, entry.Name)
+		if entry.Name == "exotic.bin" {
+			if entry.CanDecode() {
+				t.Fatal("method 7 can't be decoded")
+			}
+			if _, err := entry.Open(); !errors.Is(err, zip.ErrAlgorithm) {
+				t.Fatalf("expected zip.ErrAlgorithm, got: %v", err)
+			}
+		} else if !entry.CanDecode() {
+			t.Fatalf("%s can be decoded", entry.Name)
+		}
+	}
+	if strings.Join(names, ",") != "first.txt,exotic.bin,last.txt" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+
+	// the end of an entry with data descriptor and unknown method can't be found
+	header := rawFileHeader(&zip.FileHeader{Name: "exotic.bin", ReaderVersion: 20, Method: 7, Flags: 0x8})
+	z = NewReader(bytes.NewReader(append(header, "opaque data"...)))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.CanDecode() {
+		t.Fatal("method 7 can't be decoded")
+	}
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrCannotSkip) {
+		t.Fatalf("expected ErrCannotSkip, got: %v", err)
+	}
+}
+
+func TestDataDescriptor64WithoutZip64Extra(t *testing.T) {
+	// java.util.zip in zip64 mode writes 24-byte data descriptors for
+	// entries whose local header has no zip64 extra field
+	content := []byte("a small entry written by java.util.zip\n")
+	compressed := deflate(t, content)
+	for _, withSig := range []bool{true, false} {
+		var archive bytes.Buffer
+		archive.Write(rawFileHeader(&zip.FileHeader{
+			Name:          "small.txt",
+			ReaderVersion: 45,
+			Flags:         0x8,
+			Method:        zip.Deflate,
+		}))
+		archive.Write(compressed)
+		if withSig {
+			_ = binary.Write(&archive, binary.LittleEndian, uint32(dataDescriptorSignature))
+		}
+		_ = binary.Write(&archive, binary.LittleEndian, crc32.ChecksumIEEE(content))
+		_ = binary.Write(&archive, binary.LittleEndian, uint64(len(compressed)))
+		_ = binary.Write(&archive, binary.LittleEndian, uint64(len(content)))
+		archive.Write(rawFileHeader(&zip.FileHeader{
+			Name:             "next.txt",
+			ReaderVersion:    10,
+			CRC32:            crc32.ChecksumIEEE([]byte("next")),
+			CompressedSize:   4,
+			UncompressedSize: 4,
+		}))
+		archive.WriteString("next")
+
+		for _, raw := range []bool{false, true} {
+			z := NewReader(bytes.NewReader(archive.Bytes()))
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw {
+				r, err := entry.OpenRaw()
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(r)
+				if err != nil || !bytes.Equal(b, compressed) {
+					t.Fatalf("signature %v: read raw data fail: %v", withSig, err)
+				}
+			} else if s, err := entry.OpenString(); err != nil || s != string(content) {
+				t.Fatalf("signature %v: read entry fail: %v", withSig, err)
+			}
+			if entry.CompressedSize64 != uint64(len(compressed)) || entry.UncompressedSize64 != uint64(len(content)) {
+				t.Fatalf("signature %v: incorrect sizes %d, %d", withSig, entry.CompressedSize64, entry.UncompressedSize64)
+			}
+			if entry, err = z.GetNextEntry(); err != nil {
+				t.Fatalf("signature %v: unable to get the following entry: %s", withSig, err)
+			}
+			if s, err := entry.OpenString(); err != nil || s != "next" {
+				t.Fatalf("signature %v: read the following entry fail: %v", withSig, err)
+			}
+		}
+	}
+}
+
+func TestTolerateUnknownTrailer(t *testing.T) {
+	apk, err := os.ReadFile("testdata/signed.apk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll := func(z *Reader) ([]string, error) {
+		var names []string
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				return names, nil
+			}
+			if err != nil {
+				return names, err
+			}
+			if _, err := entry.Bytes(); err != nil {
+				return names, err
+			}
+			names = append(names, entry.Name)
+		}
+	}
+	const expected = "AndroidManifest.xml,classes.dex,res/values/strings.xml,META-INF/MANIFEST.MF"
+
+	z := NewReader(bytes.NewReader(apk), WithSigningBlocks())
+	names, err := readAll(z)
+	if err != nil || strings.Join(names, ",") != expected {
+		t.Fatalf("read APK fail: %v, %v", names, err)
+	}
+	if !z.SawCentralDirectory() || len(z.TrailingBlocks()) != 1 {
+		t.Fatal("the signing block is not recognized")
+	}
+
+	// an unrecognized block, here the signing block with another magic
+	corrupted := bytes.Replace(apk, []byte("APK Sig Block 42"), []byte("APK Sig Block 43"), 1)
+	if _, err := readAll(NewReader(bytes.NewReader(corrupted), WithSigningBlocks())); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat, got: %v", err)
+	}
+	z = NewReader(bytes.NewReader(corrupted))
+	z.SetTolerateUnknownTrailer(true)
+	names, err = readAll(z)
+	if err != nil || strings.Join(names, ",") != expected {
+		t.Fatalf("read APK with unknown trailer fail: %v, %v", names, err)
+	}
+	if z.SawCentralDirectory() {
+		t.Fatal("the central directory is not reached")
+	}
+}
+
+func TestObservedSizes(t *testing.T) {
+	content := []byte(strings.Repeat("observed\n", 50))
+	compressed := deflate(t, content)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "corrupt.txt",
+			Method:             zip.Deflate,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(compressed)),
+			UncompressedSize64: 1000, // corrupted
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(compressed); err != nil {
+			return err
+		}
+		if w, err = zw.Create("descriptor.txt"); err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = entry.Bytes()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !strings.Contains(err.Error(), fmt.Sprintf("recorded uncompressed size 1000, observed %d", len(content))) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.ObservedCompressedSize != uint64(len(compressed)) ||
+		entry.ObservedUncompressedSize != uint64(len(content)) ||
+		entry.ObservedCRC32 != crc32.ChecksumIEEE(content) {
+		t.Fatalf("incorrect observed values %d, %d, %08x", entry.ObservedCompressedSize, entry.ObservedUncompressedSize, entry.ObservedCRC32)
+	}
+
+	if entry, err = z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ObservedCompressedSize != entry.CompressedSize64 ||
+		entry.ObservedUncompressedSize != entry.UncompressedSize64 ||
+		entry.ObservedCRC32 != entry.CRC32 {
+		t.Fatal("the observed values differ from the data descriptor")
+	}
+}
+
+func TestCorruptDeflateError(t *testing.T) {
+	// a final block of the reserved type 3
+	corrupt := []byte{0x07, 0x00, 0x00, 0x00}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "corrupt.txt",
+			Method:             zip.Deflate,
+			CompressedSize64:   uint64(len(corrupt)),
+			UncompressedSize64: 10,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(corrupt)
+		return err
+	})
+
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = entry.Bytes()
+	var fe *FormatError
+	var ce flate.CorruptInputError
+	if !errors.As(err, &fe) || !errors.Is(err, zip.ErrFormat) || !errors.As(err, &ce) {
+		t.Fatalf("expected *FormatError wrapping flate.CorruptInputError, got: %v", err)
+	}
+	if fe.Name != "corrupt.txt" || fe.Offset != int64(30+len("corrupt.txt"))+int64(ce) {
+		t.Fatalf("unexpected format error: %v", fe)
+	}
+	if !strings.Contains(err.Error(), "corrupt.txt") || !strings.Contains(err.Error(), "Deflate") {
+		t.Fatalf("the error doesn't name the entry and the method: %v", err)
+	}
+}
+
+func TestDecompressorError(t *testing.T) {
+	const method = 0xfff0
+	errDecompress := errors.New("bad block")
+	decompressors.Store(uint16(method), zip.Decompressor(func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(iotest.ErrReader(errDecompress))
+	}))
+	defer decompressors.Delete(uint16(method))
+
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "custom.bin",
+			Method:             method,
+			CompressedSize64:   4,
+			UncompressedSize64: 10,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("data"))
+		return err
+	})
+
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = entry.Bytes()
+	if !errors.Is(err, errDecompress) {
+		t.Fatalf("expected the decompressor error, got: %v", err)
+	}
+	expected := `zipstream: entry 0 "custom.bin" at offset 40: method 65520 decompression failed: bad block`
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestMethodName(t *testing.T) {
+	for method, name := range map[uint16]string{
+		zip.Store:   "Store",
+		zip.Deflate: "Deflate",
+		9:           "Deflate64",
+		93:          "Zstandard",
+		7:           "method 7",
+	} {
+		if got := MethodName(method); got != name {
+			t.Errorf("MethodName(%d) = %q, expected %q", method, got, name)
+		}
+	}
+}
+
+func TestOwner(t *testing.T) {
+	f, err := os.Open("testdata/unix2.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	z := NewReader(f)
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid, ok := entry.Owner(); !ok || uid != 1000 || gid != 100 {
+		t.Fatalf("unexpected owner %d:%d, %v", uid, gid, ok)
+	}
+	if !entry.Modified.Equal(MSDosTimeToTime(entry.ModifiedDate, entry.ModifiedTime)) {
+		t.Fatal("the uid and gid are taken for a timestamp")
+	}
+	if entry, err = z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := entry.Owner(); ok {
+		t.Fatal("the entry has no owner")
+	}
+}
+
+// compareWithArchiveZip reads every entry of the archive with Open and then
+// with OpenRaw, and compares them with the view of archive/zip.
+func compareWithArchiveZip(t *testing.T, zipFile []byte) {
+	t.Helper()
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []bool{false, true} {
+		z := NewReader(bytes.NewReader(zipFile))
+		for _, zf := range az.File {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatalf("unable to get next entry: %s", err)
+			}
+			var r, expected io.Reader
+			if raw {
+				if r, err = entry.OpenRaw(); err == nil {
+					expected, err = zf.OpenRaw()
+				}
+			} else if r, err = entry.Open(); err == nil {
+				expected, err = zf.Open()
+			}
+			if err != nil {
+				t.Fatalf("open %s fail: %s", zf.Name, err)
+			}
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read %s fail: %s", zf.Name, err)
+			}
+			expectedContent, err := io.ReadAll(expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Name != zf.Name || entry.CRC32 != zf.CRC32 ||
+				entry.CompressedSize64 != zf.CompressedSize64 ||
+				entry.UncompressedSize64 != zf.UncompressedSize64 ||
+				!bytes.Equal(content, expectedContent) {
+				t.Fatalf("entry %s differs from archive/zip", zf.Name)
+			}
+		}
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got: %v", err)
+		}
+	}
+}
+
+func TestMacOSArchiveUtility(t *testing.T) {
+	// the layout of Archive Utility: data descriptors everywhere, including
+	// STORED directories, extended timestamps and AppleDouble companions
+	zipFile, err := os.ReadFile("testdata/macos.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareWithArchiveZip(t, zipFile)
+}
+
+func TestWindowsExplorer(t *testing.T) {
+	// the layout of Explorer: names in the OEM code page without the UTF-8
+	// flag, NTFS timestamps and Deflate64 for large files
+	zipFile, err := os.ReadFile("testdata/explorer.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for _, zf := range az.File {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get next entry: %s", err)
+		}
+		if entry.Name != zf.Name || !entry.NonUTF8 || entry.Method != zf.Method ||
+			entry.CRC32 != zf.CRC32 || entry.UncompressedSize64 != zf.UncompressedSize64 {
+			t.Fatalf("entry %q differs from archive/zip", zf.Name)
+		}
+		modified, accessed, created, ok := entry.NTFSTimes()
+		if !ok || !modified.Equal(entry.Modified) ||
+			accessed.Unix() != 1687780800 || created.Unix() != 1687608000 || modified.Nanosecond() != 123456700 {
+			t.Fatalf("unexpected NTFS times of %q: %v, %v, %v", zf.Name, modified, accessed, created)
+		}
+
+		rc, err := entry.Open()
+		if zf.Method == CompressMethodDeflate64 {
+			var me *UnsupportedMethodError
+			if !errors.As(err, &me) || !errors.Is(err, zip.ErrAlgorithm) || me.Name != zf.Name {
+				t.Fatalf("expected *UnsupportedMethodError, got: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		azrc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := io.ReadAll(azrc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, expected) {
+			t.Fatalf("the contents of %q differ from archive/zip", zf.Name)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestDescriptorCandidate(t *testing.T) {
+	// fakeDescriptor returns a descriptor which validates data, optionally
+	// with 8-byte sizes
+	fakeDescriptor := func(data []byte, zip64 bool) []byte {
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(dataDescriptorSignature))
+		_ = binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(data))
+		if zip64 {
+			_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+			_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+		} else {
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		}
+		return buf.Bytes()
+	}
+
+	// STORED data embedding the descriptor signature alone, and descriptors
+	// validating the data before them but not followed by a record, or
+	// followed by the signature of a local file header whose fields don't
+	// look sane
+	var content []byte
+	content = append(content, "PK\x07\x08 a bare signature "...)
+	content = append(content, fakeDescriptor(content, false)...)
+	content = append(content, "garbage after a valid descriptor"...)
+	content = append(content, fakeDescriptor(content, true)...)
+	content = append(content, "PK\x07\x08PK\x07\x08"...)
+	content = append(content, fakeDescriptor(content, false)...)
+	content = append(content, "PK\x03\x04"...)
+	content = append(content, bytes.Repeat([]byte{0xff}, fileHeaderLen)...)
+	content = append(content, bytes.Repeat([]byte("padding "), 1000)...)
+	content = append(content, fakeDescriptor(content, false)...)
+
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"adversarial.bin", "next.bin"} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for _, name := range []string{"adversarial.bin", "next.bin"} {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatalf("unable to get %s: %s", name, err)
+		}
+		b, err := entry.Bytes()
+		if err != nil {
+			t.Fatalf("read %s fail: %s", name, err)
+		}
+		if entry.Name != name || !bytes.Equal(b, content) {
+			t.Fatalf("the contents of %s are cut at a fake descriptor, %d of %d bytes", name, len(b), len(content))
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	data := []byte("data")
+	for _, tc := range []struct {
+		name     string
+		body     []byte
+		atEOF    bool
+		n        int
+		followed bool
+	}{
+		{"followed by a record", append(fakeDescriptor(data, false)[4:], "PK\x01\x02"...), false, 12, true},
+		{"at the end of the stream", fakeDescriptor(data, false)[4:], true, 12, true},
+		{"8-byte sizes", append(fakeDescriptor(data, true)[4:], rawFileHeader(&zip.FileHeader{Name: "a", ReaderVersion: 20})...), false, 20, true},
+		{"insane local file header", append(fakeDescriptor(data, false)[4:], rawFileHeader(&zip.FileHeader{Name: "a", ReaderVersion: 99})...), false, 12, false},
+		{"followed by garbage", append(fakeDescriptor(data, false)[4:], "junk"...), false, 12, false},
+		{"wrong CRC32", append(fakeDescriptor([]byte("atad"), false)[4:], "PK\x01\x02"...), false, 0, false},
+		{"short", fakeDescriptor(data, false)[4:10], true, 0, false},
+	} {
+		c := descriptorCandidate{crc: crc32.ChecksumIEEE(data), checkCRC: true, csize: 4, usize: 4}
+		if n, followed := c.match(tc.body, tc.atEOF); n != tc.n || followed != tc.followed {
+			t.Fatalf("%s: expected %d, %v, got %d, %v", tc.name, tc.n, tc.followed, n, followed)
+		}
+	}
+}
+
+func TestExpectedStreamSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "large.bin",
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	})
+	const cut = 1000
+	truncated := zipFile[:cut]
+	dataOffset := int64(30 + len("large.bin"))
+
+	for _, z := range []*Reader{
+		NewReader(bytes.NewReader(truncated)),
+		NewReader(io.MultiReader(bytes.NewReader(truncated)), WithExpectedStreamSize(cut)),
+	} {
+		_, err := z.GetNextEntry()
+		var te *TruncatedError
+		if !errors.As(err, &te) || !errors.Is(err, ErrTruncated) {
+			t.Fatalf("expected *TruncatedError, got: %v", err)
+		}
+		if te.Name != "large.bin" || te.Missing != int64(len(content))-(cut-dataOffset) || te.Offset != cut {
+			t.Fatalf("unexpected truncated error: %v", te)
+		}
+	}
+
+	// without the size, the truncation is found while reading the data
+	entry, err := NewReader(io.MultiReader(bytes.NewReader(truncated))).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got: %v", err)
+	}
+}
+
+func TestSupportsMethod(t *testing.T) {
+	z := NewReader(bytes.NewReader(nil))
+	if !z.SupportsMethod(zip.Store) || !z.SupportsMethod(zip.Deflate) {
+		t.Fatal("Store and Deflate are supported")
+	}
+	for _, method := range []uint16{CompressMethodDeflate64, 12, 14, 93, 99} {
+		if z.SupportsMethod(method) {
+			t.Fatalf("method %d is not supported", method)
+		}
+	}
+}
+
+func TestInsecureEntry(t *testing.T) {
+	names := []string{"a/b/c.txt", "../../x", "/etc/passwd", `C:\Windows\x`, "a/../../b"}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(buf.Bytes()))
+	for i, name := range names {
+		e, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Name != name {
+			t.Fatalf("expected entry %q, got %q", name, e.Name)
+		}
+		if e.Insecure != (i > 0) {
+			t.Errorf("entry %q: Insecure = %v", e.Name, e.Insecure)
+		}
+	}
+}
+
+func TestReservedNameEntry(t *testing.T) {
+	names := []string{"docs/readme.txt", "aux.txt", "dir/COM1.log", "nul"}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range names {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for i := range names {
+		e, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ReservedName != (i > 0) {
+			t.Errorf("entry %q: ReservedName = %v", e.Name, e.ReservedName)
+		}
+		if e.Insecure {
+			t.Errorf("entry %q is not insecure", e.Name)
+		}
+	}
+}
+
+func TestOpenRawNoGoroutine(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("file.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(strings.Repeat("0123456789", 100000)))
+		return err
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.hasDataDescriptor() {
+		t.Fatal("expected an entry with data descriptor")
+	}
+	before := runtime.NumGoroutine()
+	r, err := entry.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := runtime.NumGoroutine(); n != before {
+		t.Fatalf("expected %d goroutines while reading raw data, got %d", before, n)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOpenRawManyReaders checks that the raw readers of many Readers open at
+// once don't start goroutines, so that their number needs no bound.
+func TestOpenRawManyReaders(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("file.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(strings.Repeat("0123456789", 10000)))
+		return err
+	})
+
+	before := runtime.NumGoroutine()
+	readers := make([]io.Reader, 1000)
+	buf := make([]byte, 100)
+	for i := range readers {
+		entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readers[i], err = entry.OpenRaw(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(readers[i], buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := runtime.NumGoroutine(); n != before {
+		t.Fatalf("expected %d goroutines with %d raw readers open, got %d", before, len(readers), n)
+	}
+	for _, r := range readers {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEntryError(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			contents := []byte("contents of " + name)
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               name,
+				Method:             zip.Store,
+				CRC32:              crc32.ChecksumIEEE(contents),
+				CompressedSize64:   uint64(len(contents)),
+				UncompressedSize64: uint64(len(contents)),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// corrupt the contents of the second entry
+	idx := bytes.Index(zipFile, []byte("contents of b.txt"))
+	corrupted := append([]byte(nil), zipFile...)
+	corrupted[idx] ^= 0xff
+
+	z := NewReader(bytes.NewReader(corrupted))
+	for i := 0; i < 2; i++ {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = entry.Bytes()
+		if i == 0 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var ee *EntryError
+		if !errors.As(err, &ee) || !errors.Is(err, zip.ErrChecksum) {
+			t.Fatalf("expected *EntryError wrapping zip.ErrChecksum, got: %v", err)
+		}
+		end := int64(idx + len("contents of b.txt"))
+		if ee.Index != 1 || ee.Name != "b.txt" || ee.Offset != end {
+			t.Fatalf("unexpected entry error: %+v", ee)
+		}
+		expected := fmt.Sprintf(`zipstream: entry 1 "b.txt" at offset %d: zip: checksum error`, end)
+		if err.Error() != expected {
+			t.Fatalf("expected error %q, got %q", expected, err.Error())
+		}
+	}
+
+	// an invalid local file header of the second entry
+	corrupted = append([]byte(nil), zipFile...)
+	header := bytes.Index(corrupted, []byte("b.txt")) - fileHeaderLen
+	binary.LittleEndian.PutUint16(corrupted[header:], 99) // version needed to extract
+	z = NewReader(bytes.NewReader(corrupted))
+	z.SetStrict(true)
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := z.GetNextEntry()
+	var ee *EntryError
+	var he *HeaderError
+	if !errors.As(err, &ee) || !errors.As(err, &he) {
+		t.Fatalf("expected *EntryError wrapping *HeaderError, got: %v", err)
+	}
+	if ee.Index != 1 || ee.Name != "" || ee.Offset != int64(header+fileHeaderLen) {
+		t.Fatalf("unexpected entry error: %+v", ee)
+	}
+}
+
+func TestExtraStable(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for i := 0; i < 10; i++ {
+			_, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     fmt.Sprintf("file%d.txt", i),
+				Modified: time.Unix(int64(i)*1e8, 0),
+				Extra:    []byte{0xfe, 0xca, 0x02, 0x00, byte(i), byte(i)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	var entries []*Entry
+	var extras [][]byte
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+		extras = append(extras, append([]byte(nil), entry.Extra...))
+	}
+	for i, entry := range entries {
+		if !bytes.Equal(entry.Extra, extras[i]) {
+			t.Fatalf("the extra field of %s changed after the iteration", entry.Name)
+		}
+		// the bytes are the ones of the local file header
+		if len(entry.Extra) == 0 || !bytes.Contains(zipFile, append([]byte(entry.Name), entry.Extra...)) {
+			t.Fatalf("the extra field of %s differs from the local file header", entry.Name)
+		}
+	}
+}
+
+func TestUnsupportedExtras(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/pkextras.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]uint16{
+		"patched.txt": {0x000f, 0x0018},
+		"plain.txt":   {0x0007},
+	}
+	for _, strict := range []bool{false, true} {
+		z := NewReader(bytes.NewReader(zipFile))
+		z.SetStrict(strict)
+		for {
+			entry, err := z.GetNextEntry()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			ids := entry.UnsupportedExtras()
+			if !strict {
+				if len(ids) > 0 {
+					t.Fatalf("unexpected unsupported extras of %s outside strict mode: %04x", entry.Name, ids)
+				}
+				continue
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(expected[entry.Name]) {
+				t.Fatalf("expected unsupported extras %04x of %s, got %04x", expected[entry.Name], entry.Name, ids)
+			}
+		}
+	}
+}
+
+func TestManualSkip(t *testing.T) {
+	contents := strings.Repeat("0123456789", 1000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		if _, err := zw.Create("dir/"); err != nil {
+			return err
+		}
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(contents)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile), WithManualSkip())
+	// an empty entry needs no skip
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrEntryNotConsumed) {
+		t.Fatalf("expected ErrEntryNotConsumed for an unread entry, got: %v", err)
+	}
+	// a partially read and closed entry is still not consumed
+	rc, err := a.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(rc, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrEntryNotConsumed) {
+		t.Fatalf("expected ErrEntryNotConsumed for a partially read entry, got: %v", err)
+	}
+	if err := a.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if a.CRC32 != crc32.ChecksumIEEE([]byte(contents)) {
+		t.Fatal("the data descriptor of the skipped entry was not read")
+	}
+	b, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "b.txt" || a.SkippedBytes() != 0 {
+		t.Fatalf("unexpected entry %s after an explicit skip of %d bytes", b.Name, a.SkippedBytes())
+	}
+	if s, err := b.OpenString(); err != nil || s != contents {
+		t.Fatalf("unexpected contents of %s: %v", b.Name, err)
+	}
+	c, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "c.txt" {
+		t.Fatalf("expected c.txt, got %s", c.Name)
+	}
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrEntryNotConsumed) {
+		t.Fatalf("expected ErrEntryNotConsumed for the last entry, got: %v", err)
+	}
+
+	// the bytes skipped automatically are recorded
+	z = NewReader(bytes.NewReader(zipFile))
+	var entries []*Entry
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	for _, entry := range entries[1:] {
+		expected := int64(entry.CompressedSize64) + dataDescriptorLen
+		if entry.SkippedBytes() != expected {
+			t.Fatalf("expected %d bytes skipped of %s, got %d", expected, entry.Name, entry.SkippedBytes())
+		}
+	}
+}
+
+func TestOpenAllowCorrupt(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/badcrc.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the CRC32 of the first entry is wrong in both headers
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("expected zip.ErrChecksum, got: %v", err)
+	}
+	if entry.Corrupt() {
+		t.Fatal("Corrupt() is only set by OpenAllowCorrupt")
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	expected := map[string]string{
+		"damaged.txt": "salvage me, even if my checksum is wrong\n",
+		"intact.txt":  "intact\n",
+	}
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := entry.OpenAllowCorrupt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Corrupt() {
+			t.Fatal("the entry is only known to be corrupt at EOF")
+		}
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("unexpected error reading %s: %v", entry.Name, err)
+		}
+		if string(data) != expected[entry.Name] {
+			t.Fatalf("unexpected contents of %s: %q", entry.Name, data)
+		}
+		if corrupt := entry.Name == "damaged.txt"; entry.Corrupt() != corrupt {
+			t.Fatalf("expected Corrupt() %v for %s", corrupt, entry.Name)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenMulti(t *testing.T) {
+	contents := strings.Repeat("fan out ", 10000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("file.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(contents))
+		return err
+	})
+
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	h := sha256.New()
+	rc, err := entry.OpenMulti(&buf, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != contents || buf.String() != contents {
+		t.Fatal("the writers didn't receive all the contents")
+	}
+	if sum := sha256.Sum256([]byte(contents)); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Fatal("unexpected hash of the contents")
+	}
+	if entry.CRC32 != crc32.ChecksumIEEE([]byte(contents)) {
+		t.Fatal("the data descriptor was not read")
+	}
+}
+
+func TestSectorPadding(t *testing.T) {
+	// the data of each entry is padded with zero bytes to a 512 bytes
+	// boundary, as written by some firmware packagers
+	zipFile, err := os.ReadFile("testdata/sector.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func(zipFile []byte) (*Reader, error) {
+		z := NewReader(bytes.NewReader(zipFile), WithInterEntryPadding(511))
+		for _, zf := range az.File {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				return z, err
+			}
+			data, err := entry.Bytes()
+			if err != nil {
+				return z, err
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Fatalf("the contents of %s are incorrect", entry.Name)
+			}
+		}
+		_, err := z.GetNextEntry()
+		return z, err
+	}
+
+	z, err := readAll(zipFile)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	warnings := z.Warnings()
+	if len(warnings) != len(az.File) {
+		t.Fatalf("expected %d padding warnings, got %v", len(az.File), warnings)
+	}
+	for i, w := range warnings {
+		if w.Code != WarnPaddingSkipped {
+			t.Fatalf("unexpected warning %d: %v", i, w)
+		}
+	}
+
+	// garbage instead of zero bytes is not padding
+	corrupted := append([]byte(nil), zipFile...)
+	corrupted[1023] = 0xff
+	if _, err := readAll(corrupted); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat for non-zero padding, got: %v", err)
+	}
+}
+
+func TestEntrySignatureScan(t *testing.T) {
+	// the entries are followed by the markers of an upload protocol
+	zipFile, err := os.ReadFile("testdata/interstitial.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != zip.ErrFormat {
+		t.Fatalf("expected zip.ErrFormat without scan, got: %v", err)
+	}
+
+	z = NewReader(bytes.NewReader(zipFile))
+	z.SetEntrySignatureScan(true)
+	for _, zf := range az.File {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Name != zf.Name {
+			t.Fatalf("expected entry %s, got %s", zf.Name, entry.Name)
+		}
+		data, err := entry.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(data)) != zf.UncompressedSize64 || crc32.ChecksumIEEE(data) != zf.CRC32 {
+			t.Fatalf("the contents of %s are incorrect", entry.Name)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	warnings := z.Warnings()
+	if len(warnings) != len(az.File) {
+		t.Fatalf("expected %d warnings, got %v", len(az.File), warnings)
+	}
+	for _, w := range warnings {
+		if w.Code != WarnInterstitialSkipped {
+			t.Fatalf("unexpected warning: %v", w)
+		}
+	}
+
+	// the scan is bounded
+	defer func(max int) { MaxEntrySignatureScan = max }(MaxEntrySignatureScan)
+	MaxEntrySignatureScan = 8
+	z = NewReader(bytes.NewReader(zipFile))
+	z.SetEntrySignatureScan(true)
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = z.GetNextEntry()
+	var fe *FormatError
+	if !errors.As(err, &fe) || fe.Name != az.File[0].Name {
+		t.Fatalf("expected *FormatError after the first entry, got: %v", err)
+	}
+}
+
+func TestErrorPositioning(t *testing.T) {
+	contents := []byte(strings.Repeat("positioned ", 100))
+	deflated := deflate(t, contents)
+
+	// build returns an archive of the entry written by fn followed by
+	// next.txt, and the offset of the local header of next.txt
+	build := func(fn func(zw *zip.Writer) error, patch func(zipFile []byte)) ([]byte, int64) {
+		zipFile := buildZip(t, func(zw *zip.Writer) error {
+			if err := fn(zw); err != nil {
+				return err
+			}
+			w, err := zw.Create("next.txt")
+			if err != nil {
+				return err
+			}
+			_, err = w.Write([]byte("next"))
+			return err
+		})
+		if patch != nil {
+			patch(zipFile)
+		}
+		return zipFile, int64(bytes.Index(zipFile, []byte("next.txt")) - 30)
+	}
+	sized := func(method uint16, crc uint32, data []byte) func(zw *zip.Writer) error {
+		return func(zw *zip.Writer) error {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               "bad.txt",
+				Method:             method,
+				CRC32:              crc,
+				CompressedSize64:   uint64(len(data)),
+				UncompressedSize64: uint64(len(contents)),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}
+	}
+	withDescriptor := func(zw *zip.Writer) error {
+		w, err := zw.Create("bad.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(contents)
+		return err
+	}
+	// patchDescriptor adds delta to the uint32 at off in the first data
+	// descriptor
+	patchDescriptor := func(off int, delta uint32) func(zipFile []byte) {
+		return func(zipFile []byte) {
+			i := bytes.Index(zipFile, []byte("PK\x07\x08")) + off
+			binary.LittleEndian.PutUint32(zipFile[i:], binary.LittleEndian.Uint32(zipFile[i:])+delta)
+		}
+	}
+	crc := crc32.ChecksumIEEE(contents)
+
+	tests := []struct {
+		name   string
+		fn     func(zw *zip.Writer) error
+		patch  func(zipFile []byte)
+		raw    bool
+		target error
+	}{
+		{"sized CRC32 mismatch", sized(zip.Store, crc+1, contents), nil, false, zip.ErrChecksum},
+		{"sized corrupt data", sized(zip.Deflate, crc, append([]byte{0x07, 0x00, 0x00, 0x00}, deflated...)), nil, false, zip.ErrFormat},
+		{"sized padding", sized(zip.Deflate, crc, append(deflated, 0, 0, 0)), nil, false, zip.ErrFormat},
+		{"sized uncompressed size mismatch", sized(zip.Store, crc, contents[:len(contents)-1]), nil, false, io.ErrUnexpectedEOF},
+		{"descriptor CRC32 mismatch", withDescriptor, patchDescriptor(4, 1), false, zip.ErrChecksum},
+		{"descriptor compressed size mismatch", withDescriptor, patchDescriptor(8, 1), false, io.ErrUnexpectedEOF},
+		{"descriptor uncompressed size mismatch", withDescriptor, patchDescriptor(12, 1), false, io.ErrUnexpectedEOF},
+		{"raw descriptor size mismatch", withDescriptor, patchDescriptor(12, 1), true, io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zipFile, next := build(test.fn, test.patch)
+			z := NewReader(bytes.NewReader(zipFile))
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r io.Reader
+			if test.raw {
+				r, err = entry.OpenRaw()
+			} else {
+				r, err = entry.Open()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, r); !errors.Is(err, test.target) {
+				t.Fatalf("expected %v, got: %v", test.target, err)
+			}
+			if z.offset() != next {
+				t.Fatalf("expected the stream at offset %d after the error, got %d", next, z.offset())
+			}
+			entry, err = z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s, err := entry.OpenString(); err != nil || s != "next" {
+				t.Fatalf("read the next entry fail: %v", err)
+			}
+		})
+	}
+}
+
+func TestRejectControlChars(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/nulname.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// accepted by default
+	entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "evil\x00.txt" || !entry.Insecure {
+		t.Fatalf("unexpected entry %q (insecure %v)", entry.Name, entry.Insecure)
+	}
+
+	z := NewReader(bytes.NewReader(zipFile))
+	z.SetRejectControlChars(true)
+	_, err = z.GetNextEntry()
+	var fe *FormatError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected a FormatError, got %v", err)
+	}
+	if fe.Offset != 30+4 || !strings.Contains(fe.Msg, "U+0000") {
+		t.Fatalf("unexpected error %v", fe)
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.Create(name) // with data descriptor
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(bytes.Repeat([]byte(name), 1000)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	used := 0
+	z := NewReader(bytes.NewReader(zipFile))
+	z.RegisterDecompressor(zip.Deflate, func(r io.Reader) io.ReadCloser {
+		used++
+		return flate.NewReader(r)
+	})
+
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := entry.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, bytes.Repeat([]byte("a.txt"), 1000)) {
+		t.Fatal("unexpected contents")
+	}
+	// the unread entry is decompressed to find its data descriptor
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if used != 2 {
+		t.Fatalf("expected the registered decompressor to be used twice, got %d", used)
+	}
+
+	// other readers keep the built-in decompressor
+	used = 0
+	if _, err := NewReader(bytes.NewReader(zipFile)).ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if used != 0 {
+		t.Fatalf("expected the built-in decompressor, the registered one was used %d times", used)
+	}
+}
+
+func TestOpenWithDict(t *testing.T) {
+	dict := []byte("common vocabulary shared by the entries of the format")
+	contents := []byte("entries reuse the common vocabulary shared by the format")
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriterDict(&compressed, flate.BestCompression, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	crc := crc32.ChecksumIEEE(contents)
+
+	var stream bytes.Buffer
+	// a sized entry
+	stream.Write(rawFileHeader(&zip.FileHeader{
+		Name:             "sized.txt",
+		ReaderVersion:    20,
+		Method:           zip.Deflate,
+		ModifiedDate:     0x5021,
+		CRC32:            crc,
+		CompressedSize:   uint32(compressed.Len()),
+		UncompressedSize: uint32(len(contents)),
+	}))
+	stream.Write(compressed.Bytes())
+	// an entry with data descriptor
+	stream.Write(rawFileHeader(&zip.FileHeader{
+		Name:          "descriptor.txt",
+		ReaderVersion: 20,
+		Flags:         8,
+		Method:        zip.Deflate,
+		ModifiedDate:  0x5021,
+	}))
+	stream.Write(compressed.Bytes())
+	for _, v := range []uint32{dataDescriptorSignature, crc, uint32(compressed.Len()), uint32(len(contents))} {
+		_ = binary.Write(&stream, binary.LittleEndian, v)
+	}
+
+	z := NewReader(bytes.NewReader(stream.Bytes()))
+	for i := 0; i < 2; i++ {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := entry.OpenWithDict(dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%s: %v", entry.Name, err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, contents) {
+			t.Fatalf("%s: unexpected contents %q", entry.Name, got)
+		}
+	}
+
+	// without the dictionary the data doesn't decompress
+	entry, err := NewReader(bytes.NewReader(stream.Bytes())).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); err == nil {
+		t.Fatal("expected an error decompressing without the dictionary")
+	}
+}
+
+func TestRandomExtras(t *testing.T) {
+	tags := []uint16{
+		Zip64ExtraID, NtfsExtraID, UnixExtraID, ExtTimeExtraID, InfoZipUnixExtraID, InfoZipUnix2ExtraID,
+		AsiUnixExtraID, JarMarkerExtraID, ZipAlignExtraID, paddingExtraID,
+		0x000c, // OpenVMS
+		0x0009, // OS/2
+		0x4453, // Windows NT security descriptor
+		0x0017, // Strong Encryption Header
+	}
+	sizes := []int{0, 1, 2, 3, 4, 5, 8, 16, 24, 32, 36}
+	rnd := rand.New(rand.NewSource(1))
+	contents := []byte("hello")
+
+	for i := 0; i < 2000; i++ {
+		var extra []byte
+		wellFormed := true
+		for n := rnd.Intn(5); n > 0; n-- {
+			tag := tags[rnd.Intn(len(tags))]
+			if rnd.Intn(4) == 0 {
+				tag = uint16(rnd.Intn(1 << 16))
+			}
+			size := sizes[rnd.Intn(len(sizes))]
+			payload := make([]byte, size)
+			rnd.Read(payload)
+			if tag == NtfsExtraID && size >= 8 {
+				// an attribute whose size is at the boundary of the field
+				binary.LittleEndian.PutUint16(payload[4:], 1)
+				binary.LittleEndian.PutUint16(payload[6:], uint16(size-8))
+			}
+			field := make([]byte, 4, 4+size)
+			binary.LittleEndian.PutUint16(field, tag)
+			binary.LittleEndian.PutUint16(field[2:], uint16(size))
+			extra = append(extra, append(field, payload...)...)
+		}
+		switch rnd.Intn(6) {
+		case 0: // the last field declares more bytes than the extra area holds
+			if len(extra) > 0 {
+				extra = extra[:len(extra)-1]
+				wellFormed = false
+			}
+		case 1: // bytes too short for a field follow the last field
+			extra = append(extra, make([]byte, 1+rnd.Intn(3))...)
+			wellFormed = false
+		}
+
+		zipFile := buildZip(t, func(zw *zip.Writer) error {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               "random.txt",
+				Method:             zip.Store,
+				ModifiedDate:       0x5021,
+				CRC32:              crc32.ChecksumIEEE(contents),
+				CompressedSize64:   uint64(len(contents)),
+				UncompressedSize64: uint64(len(contents)),
+				Extra:              extra,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(contents)
+			return err
+		})
+
+		strict := rnd.Intn(2) == 0
+		z := NewReader(bytes.NewReader(zipFile), WithCentralDirectory())
+		z.SetStrict(strict)
+		z.SetStripAlignmentExtras(rnd.Intn(2) == 0)
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			if wellFormed || !strict {
+				t.Fatalf("extra %x: %v", extra, err)
+			}
+			continue
+		}
+		if !z.stripAlignment && !bytes.Equal(entry.Extra, extra) {
+			t.Fatalf("extra %x: got %x", extra, entry.Extra)
+		}
+		if wellFormed && len(entry.Warnings()) > 0 {
+			t.Fatalf("extra %x: unexpected warnings %v", extra, entry.Warnings())
+		}
+		if got, err := entry.Bytes(); err != nil || !bytes.Equal(got, contents) {
+			t.Fatalf("extra %x: got %q, %v", extra, got, err)
+		}
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("extra %x: expected io.EOF, got %v", extra, err)
+		}
+	}
+}
+
+func TestEntryRead(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(bytes.Repeat([]byte(name), 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	z := NewReader(bytes.NewReader(zipFile))
+
+	// lazily opened by Read
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, entry); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bytes.Repeat([]byte("a.txt"), 100)) {
+		t.Fatal("unexpected contents")
+	}
+	// read after the entry has been consumed
+	if n, err := entry.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("expected io.EOF, got %d, %v", n, err)
+	}
+	if err := entry.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// mixed with an explicit Open
+	entry, err = z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(rc, head); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, rest...), bytes.Repeat([]byte("b.txt"), 100)) {
+		t.Fatal("unexpected contents")
+	}
+
+	// a skipped entry is consumed as well
+	entry, err = z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := entry.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("expected io.EOF, got %d, %v", n, err)
+	}
+
+	// the open error is sticky
+	zipFile = buildZip(t, func(zw *zip.Writer) error {
+		_, err := zw.CreateRaw(&zip.FileHeader{Name: "ppmd.bin", Method: 98})
+		return err
+	})
+	entry, err = NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		var ume *UnsupportedMethodError
+		if _, err := entry.Read(make([]byte, 10)); !errors.As(err, &ume) {
+			t.Fatalf("expected an UnsupportedMethodError, got %v", err)
+		}
+	}
+}
+
+func TestEntryReader(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(bytes.Repeat([]byte(name), 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	z := NewReader(bytes.NewReader(zipFile))
+
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1, err := entry.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := entry.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1 != r2 {
+		t.Fatal("expected the same reader from both calls")
+	}
+	data, err := io.ReadAll(r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte("a.txt"), 100)) {
+		t.Fatalf("unexpected contents %.20q", data)
+	}
+
+	// an entry opened with OpenRaw has no decompressed reader
+	entry, err = z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.OpenRaw(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Reader(); err == nil {
+		t.Fatal("expected an error after OpenRaw")
+	}
+}
+
+func TestCurrentEntry(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	z := NewReader(bytes.NewReader(zipFile))
+	if z.CurrentEntry() != nil {
+		t.Fatal("expected no current entry")
+	}
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.CurrentEntry() != entry || entry.Opened() || entry.Consumed() {
+		t.Fatalf("unexpected state: current %v, opened %v, consumed %v", z.CurrentEntry() == entry, entry.Opened(), entry.Consumed())
+	}
+	if _, err := io.ReadAll(entry); err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Opened() || !entry.Consumed() {
+		t.Fatalf("unexpected state: opened %v, consumed %v", entry.Opened(), entry.Consumed())
+	}
+}
+
+func TestEntryInUse(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(rawFileHeader(&zip.FileHeader{
+			Name:             "slow.bin",
+			ReaderVersion:    20,
+			ModifiedDate:     0x5021,
+			CRC32:            crc32.ChecksumIEEE(make([]byte, 100)),
+			CompressedSize:   100,
+			UncompressedSize: 100,
+		}))
+	}()
+	z := NewReader(pr)
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := io.Copy(io.Discard, entry)
+		done <- err
+	}()
+	for atomic.LoadInt32(&entry.reading) == 0 {
+		runtime.Gosched()
+	}
+
+	// the stream isn't touched while the entry is read
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrEntryInUse) {
+		t.Fatalf("expected ErrEntryInUse, got %v", err)
+	}
+
+	pw.Write(make([]byte, 100))
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := z.GetNextEntry(); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestDescriptorCallback(t *testing.T) {
+	contents := bytes.Repeat([]byte("callback "), 1000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"descriptor.txt", "raw.txt", "skipped.txt"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "sized.txt",
+			Method:             zip.Store,
+			ModifiedDate:       0x5021,
+			CRC32:              crc32.ChecksumIEEE(contents),
+			CompressedSize64:   uint64(len(contents)),
+			UncompressedSize64: uint64(len(contents)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(contents)
+		return err
+	})
+
+	var calls []string
+	eofReturned := false
+	z := NewReader(bytes.NewReader(zipFile), WithDescriptorCallback(func(e *Entry) {
+		if eofReturned {
+			t.Errorf("%s: callback invoked after io.EOF", e.Name)
+		}
+		if e.CRC32 != crc32.ChecksumIEEE(contents) || e.UncompressedSize64 != uint64(len(contents)) {
+			t.Errorf("%s: callback invoked before the sizes are known: crc32 %08x, size %d", e.Name, e.CRC32, e.UncompressedSize64)
+		}
+		calls = append(calls, e.Name)
+	}))
+	readToEOF := func(r io.Reader) {
+		eofReturned = false
+		buf := make([]byte, 100)
+		for {
+			_, err := r.Read(buf)
+			if err == io.EOF {
+				eofReturned = true
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readToEOF(rc)
+
+	if entry, err = z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := entry.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readToEOF(r)
+
+	// skipped.txt is read to its end by GetNextEntry
+	eofReturned = false
+	if _, err = z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err = z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if rc, err = entry.Open(); err != nil {
+		t.Fatal(err)
+	}
+	readToEOF(rc)
+	rc.Close()
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	expected := []string{"descriptor.txt", "raw.txt", "skipped.txt", "sized.txt"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("expected callbacks for %v, got %v", expected, calls)
+	}
+}
+
+func TestMalformedNtfsExtra(t *testing.T) {
+	ntfs := func(attrs ...[]byte) []byte {
+		field := make([]byte, 8) // header and reserved
+		for _, attr := range attrs {
+			field = append(field, attr...)
+		}
+		binary.LittleEndian.PutUint16(field, NtfsExtraID)
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(field)-4))
+		return field
+	}
+	attr := func(tag, size uint16, n int) []byte {
+		b := make([]byte, 4+n)
+		binary.LittleEndian.PutUint16(b, tag)
+		binary.LittleEndian.PutUint16(b[2:], size)
+		for i := 4; i < len(b); i++ {
+			b[i] = 0x11
+		}
+		return b
+	}
+	tests := []struct {
+		name  string
+		extra []byte
+	}{
+		{"reserved cut short", []byte{0x0a, 0x00, 0x02, 0x00, 0x00, 0x00}},
+		{"attribute header only", ntfs(attr(1, 24, 0))},
+		{"attribute shorter than declared", ntfs(attr(1, 24, 16))},
+		{"attribute of 16 bytes", ntfs(attr(1, 16, 16))},
+		{"attribute of 32 bytes", ntfs(attr(1, 32, 32))},
+		{"truncated attribute header", ntfs([]byte{1, 0})},
+		{"field larger than the extra area", func() []byte {
+			e := ntfs(attr(1, 24, 24))
+			return e[:len(e)-8]
+		}()},
+	}
+	for _, test := range tests {
+		header := rawFileHeader(&zip.FileHeader{
+			Name:          "ntfs.txt",
+			ReaderVersion: 20,
+			ModifiedDate:  0x5021,
+			Extra:         test.extra,
+		})
+		entry, err := NewReader(bytes.NewReader(header)).GetNextEntry()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !entry.ntfsModified.IsZero() {
+			t.Fatalf("%s: unexpected NTFS time %v", test.name, entry.ntfsModified)
+		}
+	}
+}
+
+func TestEmptyDeflate(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/emptydeflate.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same with data descriptors
+	descriptorFile := buildZip(t, func(zw *zip.Writer) error {
+		if _, err := zw.Create("empty.txt"); err != nil {
+			return err
+		}
+		w, err := zw.Create("after.txt")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("after"))
+		return err
+	})
+
+	for _, data := range [][]byte{zipFile, descriptorFile} {
+		z := NewReader(bytes.NewReader(data))
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Method != zip.Deflate {
+			t.Fatalf("expected a deflated entry, got method %d", entry.Method)
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := rc.Read(make([]byte, 10)); n != 0 || (err != nil && err != io.EOF) {
+			t.Fatalf("expected no data, got %d, %v", n, err)
+		}
+		if n, err := rc.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+			t.Fatalf("expected io.EOF, got %d, %v", n, err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if entry.ObservedCRC32 != 0 || entry.ObservedUncompressedSize != 0 || entry.ObservedCompressedSize != 2 {
+			t.Fatalf("unexpected observed values: crc32 %08x, size %d, compressed size %d",
+				entry.ObservedCRC32, entry.ObservedUncompressedSize, entry.ObservedCompressedSize)
+		}
+
+		if entry, err = z.GetNextEntry(); err != nil {
+			t.Fatal(err)
+		}
+		if contents, err := entry.OpenString(); err != nil || contents != "after" {
+			t.Fatalf("unexpected contents %q, %v", contents, err)
+		}
+	}
+}
+
+func TestComputedCRC32(t *testing.T) {
+	names := []string{"open.txt", "raw.txt", "skipped-descriptor.txt", "skipped-sized.txt", "last.txt"}
+	contents := func(name string) []byte {
+		return bytes.Repeat([]byte(name), 50)
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range names {
+			var w io.Writer
+			var err error
+			if name == "skipped-sized.txt" {
+				w, err = zw.CreateRaw(&zip.FileHeader{
+					Name:               name,
+					Method:             zip.Store,
+					ModifiedDate:       0x5021,
+					CRC32:              crc32.ChecksumIEEE(contents(name)),
+					CompressedSize64:   uint64(len(contents(name))),
+					UncompressedSize64: uint64(len(contents(name))),
+				})
+			} else {
+				w, err = zw.Create(name)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	var entries []*Entry
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := entry.ComputedCRC32(); ok {
+			t.Fatalf("%s: unexpected computed CRC32 before reading", entry.Name)
+		}
+		switch entry.Name {
+		case "open.txt":
+			if _, err := entry.Bytes(); err != nil {
+				t.Fatal(err)
+			}
+		case "raw.txt":
+			r, err := entry.OpenRaw()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries {
+		crc, ok := entry.ComputedCRC32()
+		// OpenRaw doesn't decompress, nor does the skip of a sized entry
+		expected := entry.Name != "raw.txt" && entry.Name != "skipped-sized.txt"
+		if ok != expected {
+			t.Fatalf("%s: expected a computed CRC32 %v, got %v", entry.Name, expected, ok)
+		}
+		if ok && crc != crc32.ChecksumIEEE(contents(entry.Name)) {
+			t.Fatalf("%s: unexpected computed CRC32 %08x", entry.Name, crc)
+		}
+	}
+}
+
+func TestReportedCRC32(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/macos.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := NewReader(bytes.NewReader(zipFile))
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := entry.ReportedCRC32(); ok {
+			t.Fatalf("%s: unexpected reported CRC32 before the data descriptor is read", entry.Name)
+		}
+		if _, err := entry.Bytes(); err != nil {
+			t.Fatal(err)
+		}
+		reported, ok := entry.ReportedCRC32()
+		if !ok {
+			t.Fatalf("%s: expected a reported CRC32 once the data descriptor is read", entry.Name)
+		}
+		computed, ok := entry.ComputedCRC32()
+		if !ok || computed != reported {
+			t.Fatalf("%s: expected the computed CRC32 %08x, got %08x (%v)", entry.Name, reported, computed, ok)
+		}
+	}
+}
+
+func TestExpectSignature(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the source may have been partially consumed, e.g. by a format sniffer
+	src := io.MultiReader(strings.NewReader("#!/bin/sh\n"), bytes.NewReader(zipFile))
+	if _, err := io.ReadFull(src, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	z := NewReader(src)
+	z.SetExpectSignature(true)
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"<html><body>not found</body></html>", "PK"} {
+		z := NewReader(strings.NewReader(data))
+		z.SetExpectSignature(true)
+		_, err := z.GetNextEntry()
+		if !errors.Is(err, ErrNotZip) {
+			t.Fatalf("%q: expected ErrNotZip, got %v", data, err)
+		}
+	}
+
+	z = NewReader(bytes.NewReader(nil))
+	z.SetExpectSignature(true)
+	if _, err := z.GetNextEntry(); err != ErrEmptyStream {
+		t.Fatalf("expected ErrEmptyStream, got %v", err)
+	}
+
+	empty, err := os.ReadFile("testdata/empty.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z = NewReader(bytes.NewReader(empty))
+	z.SetExpectSignature(true)
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestChecksumHash(t *testing.T) {
+	contents := bytes.Repeat([]byte("zlib-wrapped content "), 100)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("data.bin")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(contents)
+		return err
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	z.SetChecksumHash(adler32.New)
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ChecksumSum() != 0 {
+		t.Fatal("expected no sum before reading")
+	}
+	if _, err := entry.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if sum := entry.ChecksumSum(); sum != adler32.Checksum(contents) {
+		t.Fatalf("expected adler32 %08x, got %08x", adler32.Checksum(contents), sum)
+	}
+	if _, ok := entry.ComputedCRC32(); ok {
+		t.Fatal("expected no computed CRC32 with adler32")
+	}
+
+	// CRC32 by default
+	entry, err = NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if sum := entry.ChecksumSum(); sum != crc32.ChecksumIEEE(contents) {
+		t.Fatalf("expected crc32 %08x, got %08x", crc32.ChecksumIEEE(contents), sum)
+	}
+}
+
+func TestHashers(t *testing.T) {
+	contents := bytes.Repeat([]byte("multi-chunk entry "), 10000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.bin", "b.bin"} {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	z := NewReader(bytes.NewReader(zipFile), WithHashers(map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"md5":    md5.New,
+	}))
+	sha := sha256.Sum256(contents)
+	md := md5.Sum(contents)
+	for i := 0; i < 2; i++ {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := entry.Digest("sha256"); ok {
+			t.Fatal("unexpected digest before reading")
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.CopyBuffer(io.Discard, struct{ io.Reader }{rc}, make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		// each entry has its own hashes
+		if d, ok := entry.Digest("sha256"); !ok || !bytes.Equal(d, sha[:]) {
+			t.Fatalf("%s: unexpected sha256 digest %x", entry.Name, d)
+		}
+		if d, ok := entry.Digest("md5"); !ok || !bytes.Equal(d, md[:]) {
+			t.Fatalf("%s: unexpected md5 digest %x", entry.Name, d)
+		}
+		if _, ok := entry.Digest("blake3"); ok {
+			t.Fatal("unexpected digest of an unregistered hash")
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// timeoutReader fails its nth read with a timeout, once.
+type timeoutReader struct {
+	r     io.Reader
+	reads int
+	nth   int
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == r.nth {
+		return 0, timeoutError{}
+	}
+	return r.r.Read(p)
+}
+
+func TestReadTimeout(t *testing.T) {
+	contents := bytes.Repeat([]byte("0123456789"), 10000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"sized.bin", "raw.bin"} {
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               name,
+				Method:             zip.Store,
+				ModifiedDate:       0x5021,
+				CRC32:              crc32.ChecksumIEEE(contents),
+				CompressedSize64:   uint64(len(contents)),
+				UncompressedSize64: uint64(len(contents)),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// reads until the data is read, retrying after a timeout
+	readAll := func(r io.Reader) []byte {
+		var buf bytes.Buffer
+		timeouts := 0
+		for {
+			_, err := buf.ReadFrom(r)
+			if err == nil {
+				break
+			}
+			if !isTimeout(err) {
+				t.Fatal(err)
+			}
+			timeouts++
+		}
+		if timeouts != 1 {
+			t.Fatalf("expected a timeout, got %d", timeouts)
+		}
+		return buf.Bytes()
+	}
+
+	src := &timeoutReader{r: bytes.NewReader(zipFile), nth: 5}
+	z := NewReader(src)
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readAll(rc), contents) {
+		t.Fatal("unexpected contents")
+	}
+
+	entry, err = z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.reads, src.nth = 0, 5
+	r, err := entry.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readAll(r), contents) {
+		t.Fatal("unexpected contents")
+	}
+}
+
+// timeoutAtReader fails with a timeout, once, when the read reaches at.
+type timeoutAtReader struct {
+	r      io.Reader
+	offset int64
+	at     int64
+}
+
+func (r *timeoutAtReader) Read(p []byte) (int, error) {
+	if r.at >= 0 && r.offset+int64(len(p)) > r.at {
+		if r.offset == r.at {
+			r.at = -1
+			return 0, timeoutError{}
+		}
+		p = p[:r.at-r.offset]
+	}
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func TestReadTimeoutDescriptor(t *testing.T) {
+	contents := bytes.Repeat([]byte("0123456789"), 100)
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		zipFile := buildZip(t, func(zw *zip.Writer) error {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: "data.bin", Method: method})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+			if w, err = zw.Create("next.txt"); err != nil {
+				return err
+			}
+			_, err = w.Write([]byte("next"))
+			return err
+		})
+		az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dataOffset, err := az.File[0].DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		descriptor := dataOffset + int64(az.File[0].CompressedSize64)
+		compressed := zipFile[dataOffset:descriptor]
+
+		// the timeout hits before and within the descriptor, reading the
+		// decompressed data and the raw data
+		for _, at := range []int64{descriptor, descriptor + 4, descriptor + 12} {
+			for _, raw := range []bool{false, true} {
+				z := NewReader(&timeoutAtReader{r: bytes.NewReader(zipFile), at: at})
+				entry, err := z.GetNextEntry()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var r io.Reader = entry
+				expected := contents
+				if raw {
+					if r, err = entry.OpenRaw(); err != nil {
+						t.Fatal(err)
+					}
+					expected = compressed
+				}
+				var buf bytes.Buffer
+				timeouts := 0
+				for {
+					_, err := buf.ReadFrom(r)
+					if err == nil {
+						break
+					}
+					if !isTimeout(err) {
+						t.Fatalf("method %d, raw %v, timeout at %d: %v", method, raw, at, err)
+					}
+					timeouts++
+				}
+				// a timeout met while bytes can be handed out is
+				// retried by the next read
+				if timeouts > 1 || !bytes.Equal(buf.Bytes(), expected) {
+					t.Fatalf("method %d, raw %v, timeout at %d: %d timeouts, unexpected contents", method, raw, at, timeouts)
+				}
+				if entry, err = z.GetNextEntry(); err != nil || entry.Name != "next.txt" {
+					t.Fatalf("method %d, raw %v, timeout at %d: unable to get the following entry: %v", method, raw, at, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// ReaderAtMemoryLimit is the decompressed size above which Entry.ReaderAt
+// spills the entry contents to a temporary file instead of keeping them in
+// memory.
+var ReaderAtMemoryLimit int64 = 8 << 20
+
+// ReaderAt decompresses the whole entry once and returns an io.ReaderAt of
+// its contents, for consumers needing random access. The contents are kept in
+// memory up to ReaderAtMemoryLimit and in a temporary file above it, in which
+// case the returned value also implements io.Closer, closing it removes the
+// temporary file.
+func (e *Entry) ReaderAt() (io.ReaderAt, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(rc, ReaderAtMemoryLimit+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) <= ReaderAtMemoryLimit {
+		return bytes.NewReader(buf.Bytes()), nil
+	}
+
+	f, err := os.CreateTemp("", "zipstream-*")
+	if err != nil {
+		return nil, err
+	}
+	fr := &fileReaderAt{f: f}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		fr.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		fr.Close()
+		return nil, err
+	}
+	return fr, nil
+}
+
+// fileReaderAt serves ReadAt from a temporary file, which is removed on Close.
+type fileReaderAt struct {
+	f *os.File
+}
+
+func (r *fileReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.f.ReadAt(p, off)
+}
+
+func (r *fileReaderAt) Close() error {
+	err := r.f.Close()
+	if err1 := os.Remove(r.f.Name()); err == nil {
+		err = err1
+	}
+	return err
+}
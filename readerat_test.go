@@ -0,0 +1,61 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestReaderAt(t *testing.T) {
+	content := make([]byte, 100*1024)
+	for i := range content {
+		content[i] = byte(i*7 + i/251)
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		w, err := zw.Create("data.bin")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	})
+
+	defer func(limit int64) { ReaderAtMemoryLimit = limit }(ReaderAtMemoryLimit)
+	for _, limit := range []int64{1 << 20, 4096} {
+		ReaderAtMemoryLimit = limit
+		entry, err := NewReader(bytes.NewReader(zipFile)).GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ra, err := entry.ReaderAt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, off := range []int64{0, 99 * 1024, 12345, 4095, 50000, 1} {
+			p := make([]byte, 1000)
+			n, err := ra.ReadAt(p, off)
+			if err != nil && !(err == io.EOF && off+int64(n) == int64(len(content))) {
+				t.Fatalf("limit %d: ReadAt(%d) fail: %v", limit, off, err)
+			}
+			if !bytes.Equal(p[:n], content[off:off+int64(n)]) {
+				t.Fatalf("limit %d: ReadAt(%d) returns incorrect data", limit, off)
+			}
+		}
+
+		c, ok := ra.(io.Closer)
+		if ok != (limit < int64(len(content))) {
+			t.Fatalf("limit %d: only the contents spilled to a file need closing", limit)
+		}
+		if ok {
+			name := ra.(*fileReaderAt).f.Name()
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Fatalf("the temporary file is not removed: %v", err)
+			}
+		}
+	}
+}
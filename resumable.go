@@ -0,0 +1,133 @@
+package zipstream
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// MaxResumeAttempts is the number of times in a row a resumable source is
+// reopened at the same offset before its read error is returned.
+var MaxResumeAttempts = 3
+
+// NewResumableReader returns a Reader of a source which is reopened where it
+// failed, e.g. with an HTTP Range request. rf opens the source at a byte
+// offset. When opening or reading the source fails with a network error or
+// io.ErrUnexpectedEOF, the source is closed and reopened at the offset of the
+// first byte not read yet, any other error is returned as is. Reader.Close
+// closes the source currently open.
+func NewResumableReader(rf func(offset int64) (io.ReadCloser, error), opts ...Option) *Reader {
+	z := NewReader(&resumableReader{open: rf}, opts...)
+	z.ownSource = true
+	return z
+}
+
+// resumableReader reads a source reopened at the current offset on error.
+type resumableReader struct {
+	open     func(offset int64) (io.ReadCloser, error)
+	offset   int64 // offset of the next byte to read
+	attempts int   // reopen attempts without progress
+	err      error // sticky error
+
+	mu     sync.Mutex // guards rc and closed, Close may be called during a Read
+	rc     io.ReadCloser
+	closed bool
+}
+
+func (r *resumableReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		rc, err := r.source()
+		if err == ErrClosed {
+			r.err = err
+			continue
+		}
+		if err != nil {
+			r.fail(err)
+			continue
+		}
+		n, err := rc.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.attempts = 0
+		}
+		if err != nil {
+			r.closeSource()
+			if err == io.EOF {
+				r.err = io.EOF
+			} else {
+				r.fail(err)
+			}
+		}
+		if n > 0 || err == nil {
+			return n, nil
+		}
+	}
+	return 0, r.err
+}
+
+// source returns the open source, opening it at the current offset if needed.
+func (r *resumableReader) source() (io.ReadCloser, error) {
+	r.mu.Lock()
+	rc, closed := r.rc, r.closed
+	r.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if rc != nil {
+		return rc, nil
+	}
+	rc, err := r.open(r.offset)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		// closed while opening
+		rc.Close()
+		return nil, ErrClosed
+	}
+	r.rc = rc
+	return rc, nil
+}
+
+// closeSource closes the open source, the next read reopens it.
+func (r *resumableReader) closeSource() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+}
+
+func (r *resumableReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// fail counts a failed attempt, the error is kept once MaxResumeAttempts
+// attempts in a row have failed, or at once if it is not transient.
+func (r *resumableReader) fail(err error) {
+	r.attempts++
+	if r.attempts > MaxResumeAttempts || !isTransient(err) {
+		r.err = err
+	}
+}
+
+// isTransient reports whether err is a network error or an unexpected end of
+// the source, after which reopening the source may succeed.
+func isTransient(err error) bool {
+	var oe *net.OpError
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &oe) || isTimeout(err)
+}
@@ -0,0 +1,124 @@
+package zipstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// flakyReader fails once when the read reaches failAt.
+type flakyReader struct {
+	r      io.Reader
+	offset int64
+	failAt int64
+	closed bool
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.failAt >= 0 && f.offset+int64(len(p)) > f.failAt {
+		p = p[:f.failAt-f.offset]
+		if len(p) == 0 {
+			return 0, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+		}
+	}
+	n, err := f.r.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *flakyReader) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestResumableReader(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewReader(bytes.NewReader(zipFile)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offsets []int64
+	failAt := int64(len(zipFile) / 3)
+	z := NewResumableReader(func(offset int64) (io.ReadCloser, error) {
+		offsets = append(offsets, offset)
+		f := &flakyReader{r: bytes.NewReader(zipFile[offset:]), offset: offset, failAt: failAt}
+		failAt = -1 // fail only once
+		return f, nil
+	})
+	files, err := z.ReadAll()
+	if err != nil {
+		t.Fatalf("read the archive fail: %s", err)
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(files))
+	}
+	for name, content := range expected {
+		if !bytes.Equal(files[name], content) {
+			t.Fatalf("the contents of %s are incorrect", name)
+		}
+	}
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != int64(len(zipFile)/3) {
+		t.Fatalf("unexpected offsets the source is opened at: %v", offsets)
+	}
+
+	// a source failing for good
+	errDown := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("host is down")}
+	opened := 0
+	z = NewResumableReader(func(offset int64) (io.ReadCloser, error) {
+		opened++
+		return nil, errDown
+	})
+	if _, err := z.GetNextEntry(); !errors.Is(err, errDown) {
+		t.Fatalf("expected the source error, got: %v", err)
+	}
+	if opened != MaxResumeAttempts+1 {
+		t.Fatalf("expected %d attempts, got %d", MaxResumeAttempts+1, opened)
+	}
+
+	// an error other than a network one is not retried
+	errDenied := errors.New("403 Forbidden")
+	opened = 0
+	z = NewResumableReader(func(offset int64) (io.ReadCloser, error) {
+		opened++
+		return nil, errDenied
+	})
+	if _, err := z.GetNextEntry(); !errors.Is(err, errDenied) || opened != 1 {
+		t.Fatalf("expected the source error after 1 attempt, got %v after %d", err, opened)
+	}
+}
+
+func TestResumableReaderClose(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []*flakyReader
+	z := NewResumableReader(func(offset int64) (io.ReadCloser, error) {
+		f := &flakyReader{r: bytes.NewReader(zipFile[offset:]), offset: offset, failAt: -1}
+		sources = append(sources, f)
+		return f, nil
+	})
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || !sources[0].closed {
+		t.Fatal("the source is not closed")
+	}
+	if _, err := z.GetNextEntry(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got: %v", err)
+	}
+	if len(sources) != 1 {
+		t.Fatal("the source is reopened after Close")
+	}
+}
@@ -0,0 +1,139 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestZipWriterRoundTrip reads archives written by zip.Writer to a
+// non-seekable destination, where every entry has a data descriptor, with
+// every combination of Open, OpenRaw and skipping the entries.
+func TestZipWriterRoundTrip(t *testing.T) {
+	large := make([]byte, 64*1024) // larger than the read chunks
+	rand.New(rand.NewSource(1)).Read(large)
+	text := []byte(strings.Repeat("the quick brown fox\n", 1000))
+	// the descriptor signature inside STORED data
+	tricky := []byte("data PK\x07\x08 with descriptor signatures PK\x07\x08\x00\x00\x00\x00")
+
+	type file struct {
+		name    string
+		method  uint16
+		raw     bool // written with CreateRaw and a data descriptor
+		content []byte
+	}
+	files := []file{
+		{name: "deflate.txt", method: zip.Deflate, content: text},
+		{name: "store.txt", method: zip.Store, content: text},
+		{name: "store-tricky.bin", method: zip.Store, content: tricky},
+		{name: "raw-deflate.txt", method: zip.Deflate, raw: true, content: text},
+		{name: "raw-store.bin", method: zip.Store, raw: true, content: tricky},
+		{name: "empty-deflate.txt", method: zip.Deflate},
+		{name: "empty-store.txt", method: zip.Store},
+		{name: "dir/", method: zip.Store},
+		{name: "dir/large-deflate.bin", method: zip.Deflate, content: large},
+		{name: "dir/large-store.bin", method: zip.Store, content: large},
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, f := range files {
+			fh := &zip.FileHeader{Name: f.name, Method: f.method}
+			if !f.raw {
+				w, err := zw.CreateHeader(fh)
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write(f.content); err != nil {
+					return err
+				}
+				continue
+			}
+			data := f.content
+			if f.method == zip.Deflate {
+				data = deflate(t, f.content)
+			}
+			fh.Flags = 0x8
+			fh.CRC32 = crc32.ChecksumIEEE(f.content)
+			fh.CompressedSize64 = uint64(len(data))
+			fh.UncompressedSize64 = uint64(len(f.content))
+			w, err := zw.CreateRaw(fh)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, zf := range az.File {
+		if zf.Flags&0x8 == 0 && !zf.Mode().IsDir() {
+			t.Fatalf("%s has no data descriptor", zf.Name)
+		}
+		if zf.Name != files[i].name {
+			t.Fatalf("unexpected entry %s", zf.Name)
+		}
+	}
+
+	const (
+		modeOpen = iota
+		modeOpenRaw
+		modeSkip
+		modes
+	)
+	for pass := 0; pass < modes; pass++ {
+		z := NewReader(bytes.NewReader(zipFile))
+		for i, zf := range az.File {
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatalf("pass %d: unable to get %s: %s", pass, zf.Name, err)
+			}
+			if entry.Name != zf.Name {
+				t.Fatalf("pass %d: expected %s, got %s", pass, zf.Name, entry.Name)
+			}
+			var r, expected io.Reader
+			switch (i + pass) % modes {
+			case modeOpen:
+				if r, err = entry.Open(); err == nil {
+					expected, err = zf.Open()
+				}
+			case modeOpenRaw:
+				if r, err = entry.OpenRaw(); err == nil {
+					expected, err = zf.OpenRaw()
+				}
+			}
+			if err != nil {
+				t.Fatalf("pass %d: open %s fail: %s", pass, zf.Name, err)
+			}
+			if r != nil {
+				content, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("pass %d: read %s fail: %s", pass, zf.Name, err)
+				}
+				expectedContent, err := io.ReadAll(expected)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(content, expectedContent) {
+					t.Fatalf("pass %d: the contents of %s differ from archive/zip", pass, zf.Name)
+				}
+			} else if err := entry.skip(); err != nil {
+				t.Fatalf("pass %d: skip %s fail: %s", pass, zf.Name, err)
+			}
+			if entry.CRC32 != zf.CRC32 || entry.CompressedSize64 != zf.CompressedSize64 ||
+				entry.UncompressedSize64 != zf.UncompressedSize64 {
+				t.Fatalf("pass %d: the sizes or CRC32 of %s differ from archive/zip", pass, zf.Name)
+			}
+		}
+		if _, err := z.GetNextEntry(); err != io.EOF {
+			t.Fatalf("pass %d: expected io.EOF, got: %v", pass, err)
+		}
+	}
+}
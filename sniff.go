@@ -0,0 +1,33 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// OpenSniffed opens the entry like Open and detects the MIME type of its
+// contents with http.DetectContentType, e.g. to route the entries by content
+// while extracting them. The first 512 decompressed bytes are read ahead,
+// the returned reader still yields the whole contents.
+func (e *Entry) OpenSniffed() (io.ReadCloser, string, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		rc.Close()
+		return nil, "", err
+	}
+	head = head[:n]
+	sniffed := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), rc), rc}
+	return sniffed, http.DetectContentType(head), nil
+}
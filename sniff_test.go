@@ -0,0 +1,59 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestOpenSniffed(t *testing.T) {
+	text := bytes.Repeat([]byte("plain text line\n"), 100)
+	png := append([]byte("\x89PNG\x0d\x0a\x1a\x0a"), make([]byte, 100)...)
+	files := []struct {
+		name     string
+		contents []byte
+		mimeType string
+	}{
+		{"readme.txt", text, "text/plain; charset=utf-8"},
+		{"image.png", png, "image/png"},
+		{"empty", nil, "text/plain; charset=utf-8"},
+	}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, f := range files {
+			w, err := zw.Create(f.name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(f.contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	z := NewReader(bytes.NewReader(zipFile))
+	for _, f := range files {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, mimeType, err := entry.OpenSniffed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mimeType != f.mimeType {
+			t.Fatalf("%s: expected MIME type %q, got %q", f.name, f.mimeType, mimeType)
+		}
+		contents, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, f.contents) {
+			t.Fatalf("%s: unexpected contents", f.name)
+		}
+	}
+}
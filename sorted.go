@@ -0,0 +1,157 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// ErrNotSeekable is returned by Reader.SortedEntries when the source is not an
+// io.ReaderAt of known size.
+var ErrNotSeekable = errors.New("zipstream: the source is not an io.ReaderAt of known size")
+
+// SortedEntries returns the entries recorded in the central directory sorted
+// by name, for a source which is an io.ReaderAt of known size, such as an
+// *os.File or a *bytes.Reader. Each entry is read from its own section of the
+// source, so that the entries can be opened in any order, independently of
+// the iteration with GetNextEntry.
+func (z *Reader) SortedEntries() ([]*Entry, error) {
+	ra, ok := z.src.r.(io.ReaderAt)
+	size := z.sourceSize()
+	if !ok || size < 0 {
+		return nil, ErrNotSeekable
+	}
+	records, base, err := readDirectoryAt(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+
+	entries := make([]*Entry, 0, len(records))
+	names := make(map[string]string)
+	manifestSeen := make([]bool, len(z.manifest))
+	for _, d := range records {
+		offset := base + d.HeaderOffset
+		if offset < 0 || offset >= size {
+			return nil, &FormatError{Name: d.Name, Offset: offset, Msg: "local file header offset out of the source"}
+		}
+		sub := NewReader(io.NewSectionReader(ra, offset, size-offset))
+		// the offsets, and so the size, are the ones of the source
+		sub.src.n, sub.streamSize = offset, size
+		sub.readerSettings = z.readerSettings
+		sub.allowMissingDir = true
+		// the duplicates and the manifest are checked across the entries
+		sub.names, sub.manifestSeen = names, manifestSeen
+		entry, err := sub.GetNextEntry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// sourceSize returns the size of the source, -1 if unknown.
+func (z *Reader) sourceSize() int64 {
+	switch sr := z.src.r.(type) {
+	case interface{ Size() int64 }:
+		return sr.Size()
+	case interface {
+		Stat() (os.FileInfo, error)
+	}:
+		if fi, err := sr.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return z.streamSize
+}
+
+// readDirectoryAt reads the central directory records of the archive ending
+// at size. base is the offset of the start of the archive in ra, to which the
+// header offsets are relative.
+func readDirectoryAt(ra io.ReaderAt, size int64) (records []DirectoryEntry, base int64, err error) {
+	tailLen := int64(headerIdentifierLen + directoryEndLen + 0xffff)
+	if tailLen > size {
+		tailLen = size
+	}
+	tail := make([]byte, tailLen)
+	if _, err := ra.ReadAt(tail, size-tailLen); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	// the last end of central directory record whose comment ends the source
+	end := -1
+	for i := len(tail) - headerIdentifierLen - directoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == directoryEndSignature &&
+			i+headerIdentifierLen+directoryEndLen+int(binary.LittleEndian.Uint16(tail[i+20:])) == len(tail) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, 0, ErrCentralDirNotFound
+	}
+	endOffset := size - tailLen + int64(end)
+	b := readBuf(tail[end+headerIdentifierLen:])
+	b.sub(6) // disk numbers, number of records on this disk
+	count := int64(b.uint16())
+	dirSize := int64(b.uint32())
+	dirOffset := int64(b.uint32())
+	dirEnd := endOffset
+
+	if count == 0xffff || dirSize == 0xffffffff || dirOffset == 0xffffffff {
+		// the zip64 end of central directory locator precedes the record
+		locOffset := endOffset - headerIdentifierLen - directory64LocLen
+		if locOffset < 0 {
+			return nil, 0, ErrCentralDirNotFound
+		}
+		loc := make([]byte, headerIdentifierLen+directory64LocLen)
+		if _, err := ra.ReadAt(loc, locOffset); err != nil {
+			return nil, 0, err
+		}
+		if binary.LittleEndian.Uint32(loc) != directory64LocSignature {
+			return nil, 0, ErrCentralDirNotFound
+		}
+		end64Offset := locOffset - headerIdentifierLen - 8 - directory64EndLen
+		if end64Offset < 0 {
+			return nil, 0, ErrCentralDirNotFound
+		}
+		end64 := make([]byte, headerIdentifierLen+8+directory64EndLen)
+		if _, err := ra.ReadAt(end64, end64Offset); err != nil {
+			return nil, 0, err
+		}
+		b := readBuf(end64)
+		if b.uint32() != directory64EndSignature {
+			return nil, 0, ErrCentralDirNotFound
+		}
+		b.sub(8 + 4 + 8) // record size, versions, disk numbers
+		b.uint64()       // number of records on this disk
+		count = int64(b.uint64())
+		dirSize = int64(b.uint64())
+		dirOffset = int64(b.uint64())
+		dirEnd = end64Offset
+	}
+
+	// a prefix, such as the stub of a self-extracting archive, shifts the
+	// central directory and the local file headers alike
+	base = dirEnd - dirSize - dirOffset
+	if base < 0 || dirSize < 0 || count < 0 {
+		return nil, 0, zip.ErrFormat
+	}
+	z := NewReader(io.NewSectionReader(ra, base+dirOffset, dirSize))
+	for i := int64(0); i < count; i++ {
+		if err := z.expectSignature(directoryHeaderSignature); err != nil {
+			return nil, 0, err
+		}
+		d, err := z.readDirectoryHeader()
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, d)
+	}
+	return records, base, nil
+}
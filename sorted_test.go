@@ -0,0 +1,152 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSortedEntries(t *testing.T) {
+	names := []string{"c.txt", "a.txt", "b.txt"}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range names {
+			w, err := zw.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(bytes.Repeat([]byte(name), 100)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// a prefix shifts the archive, as for a self-extracting archive
+	zipFile = append([]byte("#!/bin/sh\nexit 0\n"), zipFile...)
+
+	entries, err := NewReader(bytes.NewReader(zipFile)).SortedEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.txt", "b.txt", "c.txt"}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Name != expected[i] {
+			t.Fatalf("expected entry %d named %q, got %q", i, expected[i], entry.Name)
+		}
+	}
+	// the entries are opened in sorted order, not in the physical one
+	for _, entry := range entries {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%s: %v", entry.Name, err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, bytes.Repeat([]byte(entry.Name), 100)) {
+			t.Fatalf("%s: unexpected contents", entry.Name)
+		}
+	}
+
+	if _, err := NewReader(iotest.OneByteReader(bytes.NewReader(zipFile))).SortedEntries(); err != ErrNotSeekable {
+		t.Fatalf("expected ErrNotSeekable, got %v", err)
+	}
+}
+
+func TestSortedEntriesSettings(t *testing.T) {
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"b.txt", "README", "readme"} {
+			if _, err := zw.Create(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// the duplicates are detected across the entries
+	entries, err := NewReader(bytes.NewReader(zipFile), WithDuplicateDetection(DuplicateFoldCase)).SortedEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		warned := false
+		for _, w := range entry.Warnings() {
+			warned = warned || w.Code == WarnDuplicateName
+		}
+		if warned != (entry.Name == "readme") {
+			t.Errorf("entry %d %q: unexpected warnings %v", i, entry.Name, entry.Warnings())
+		}
+	}
+
+	// the manifest and the rejection of control characters apply
+	z := NewReader(bytes.NewReader(zipFile), WithManifest([]ManifestEntry{{Name: "b.txt"}}, true))
+	z.SetStrict(true)
+	var mErr *ManifestError
+	if _, err := z.SortedEntries(); !errors.As(err, &mErr) || mErr.Field != "unexpected" {
+		t.Fatalf("expected an unexpected entry, got: %v", err)
+	}
+	zipFile = bytes.Replace(zipFile, []byte("b.txt"), []byte("b\x01txt"), -1)
+	z = NewReader(bytes.NewReader(zipFile))
+	z.SetRejectControlChars(true)
+	var fe *FormatError
+	if _, err := z.SortedEntries(); !errors.As(err, &fe) {
+		t.Fatalf("expected a FormatError, got: %v", err)
+	}
+}
+
+func TestSortedEntriesSized(t *testing.T) {
+	names := []string{"f3.txt", "f0.txt", "f2.txt", "f1.txt"}
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range names {
+			contents := bytes.Repeat([]byte(name), 50)
+			w, err := zw.CreateRaw(&zip.FileHeader{
+				Name:               name,
+				Method:             zip.Store,
+				CRC32:              crc32.ChecksumIEEE(contents),
+				CompressedSize64:   uint64(len(contents)),
+				UncompressedSize64: uint64(len(contents)),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	entries, err := NewReader(bytes.NewReader(zipFile)).SortedEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(names) {
+		t.Fatalf("expected %d entries, got %d", len(names), len(entries))
+	}
+	for i, entry := range entries {
+		if expected := fmt.Sprintf("f%d.txt", i); entry.Name != expected {
+			t.Fatalf("expected entry %d named %q, got %q", i, expected, entry.Name)
+		}
+		contents, err := entry.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", entry.Name, err)
+		}
+		if !bytes.Equal(contents, bytes.Repeat([]byte(entry.Name), 50)) {
+			t.Fatalf("%s: unexpected contents", entry.Name)
+		}
+	}
+}
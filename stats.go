@@ -0,0 +1,138 @@
+package zipstream
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// StatsCollector receives the counters of the Readers it is installed on with
+// WithStats. A collector shared by Readers used in several goroutines must be
+// safe for concurrent use, as StatsCounter is.
+type StatsCollector interface {
+	ArchiveStarted()            // the first entry of an archive is read
+	ArchiveFinished()           // GetNextEntry returned io.EOF
+	AddBytesIn(n int64)         // n bytes were read from the source
+	EntryDone(info EntryStats)  // the Reader moved past the entry
+	ChecksumFailed()            // the CRC32 of an entry didn't match
+	FlateReaderOpened(hit bool) // a Deflate decompressor was taken from the pool, or created if hit is false
+}
+
+// EntryStats describes an entry the Reader moved past, see
+// StatsCollector.EntryDone.
+type EntryStats struct {
+	Method           uint16
+	CompressedSize   uint64
+	UncompressedSize uint64
+	DataDescriptor   bool // the sizes were recorded in a data descriptor
+	Skipped          bool // the rest of the data was skipped by GetNextEntry or Entry.Skip
+}
+
+// WithStats reports the activity of the Reader to c. Without collector, the
+// Reader doesn't count anything.
+func WithStats(c StatsCollector) Option {
+	return func(z *Reader) {
+		z.collector = c
+		z.src.collector = c
+	}
+}
+
+// StatsCounter is a StatsCollector accumulating the counters with atomic
+// updates, which may be shared by Readers used concurrently.
+type StatsCounter struct {
+	archivesStarted       int64
+	archivesFinished      int64
+	bytesIn               int64
+	entries               int64
+	compressedBytes       int64
+	uncompressedBytes     int64
+	withDataDescriptor    int64
+	withoutDataDescriptor int64
+	skipped               int64
+	checksumFailures      int64
+	poolHits              int64
+	poolMisses            int64
+}
+
+// StatsSnapshot holds the counters of a StatsCounter at a point in time.
+type StatsSnapshot struct {
+	ArchivesStarted       int64
+	ArchivesFinished      int64
+	BytesIn               int64 // bytes read from the sources
+	Entries               int64
+	CompressedBytes       int64
+	UncompressedBytes     int64
+	WithDataDescriptor    int64
+	WithoutDataDescriptor int64
+	Skipped               int64 // entries whose data was skipped, at least in part
+	ChecksumFailures      int64
+	PoolHits              int64 // Deflate decompressors reused
+	PoolMisses            int64 // Deflate decompressors created
+}
+
+func (c *StatsCounter) ArchiveStarted()    { atomic.AddInt64(&c.archivesStarted, 1) }
+func (c *StatsCounter) ArchiveFinished()   { atomic.AddInt64(&c.archivesFinished, 1) }
+func (c *StatsCounter) AddBytesIn(n int64) { atomic.AddInt64(&c.bytesIn, n) }
+func (c *StatsCounter) ChecksumFailed()    { atomic.AddInt64(&c.checksumFailures, 1) }
+
+func (c *StatsCounter) EntryDone(info EntryStats) {
+	atomic.AddInt64(&c.entries, 1)
+	atomic.AddInt64(&c.compressedBytes, int64(info.CompressedSize))
+	atomic.AddInt64(&c.uncompressedBytes, int64(info.UncompressedSize))
+	if info.DataDescriptor {
+		atomic.AddInt64(&c.withDataDescriptor, 1)
+	} else {
+		atomic.AddInt64(&c.withoutDataDescriptor, 1)
+	}
+	if info.Skipped {
+		atomic.AddInt64(&c.skipped, 1)
+	}
+}
+
+func (c *StatsCounter) FlateReaderOpened(hit bool) {
+	if hit {
+		atomic.AddInt64(&c.poolHits, 1)
+	} else {
+		atomic.AddInt64(&c.poolMisses, 1)
+	}
+}
+
+// Snapshot returns the current counters.
+func (c *StatsCounter) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		ArchivesStarted:       atomic.LoadInt64(&c.archivesStarted),
+		ArchivesFinished:      atomic.LoadInt64(&c.archivesFinished),
+		BytesIn:               atomic.LoadInt64(&c.bytesIn),
+		Entries:               atomic.LoadInt64(&c.entries),
+		CompressedBytes:       atomic.LoadInt64(&c.compressedBytes),
+		UncompressedBytes:     atomic.LoadInt64(&c.uncompressedBytes),
+		WithDataDescriptor:    atomic.LoadInt64(&c.withDataDescriptor),
+		WithoutDataDescriptor: atomic.LoadInt64(&c.withoutDataDescriptor),
+		Skipped:               atomic.LoadInt64(&c.skipped),
+		ChecksumFailures:      atomic.LoadInt64(&c.checksumFailures),
+		PoolHits:              atomic.LoadInt64(&c.poolHits),
+		PoolMisses:            atomic.LoadInt64(&c.poolMisses),
+	}
+}
+
+// entryDone reports the entry the Reader moves past to the collector, once.
+func (z *Reader) entryDone(e *Entry) {
+	if e.reported {
+		return
+	}
+	e.reported = true
+	z.collector.EntryDone(EntryStats{
+		Method:           e.Method,
+		CompressedSize:   e.CompressedSize64,
+		UncompressedSize: e.UncompressedSize64,
+		DataDescriptor:   e.hasDataDescriptor(),
+		Skipped:          e.skippedData,
+	})
+}
+
+// decompressorOpened reports to the collector whether the Deflate
+// decompressor fr was reused from the pool.
+func (z *Reader) decompressorOpened(fr io.Reader) {
+	if pfr, ok := fr.(*pooledFlateReader); ok && z.collector != nil {
+		z.collector.FlateReaderOpened(pfr.reused)
+	}
+}
@@ -0,0 +1,165 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestStatsCounter(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every other entry is read, the others are skipped
+	var expected StatsSnapshot
+	var deflated int64
+	for i, zf := range az.File {
+		expected.Entries++
+		expected.CompressedBytes += int64(zf.CompressedSize64)
+		expected.UncompressedBytes += int64(zf.UncompressedSize64)
+		if zf.Flags&8 != 0 {
+			expected.WithDataDescriptor++
+		} else {
+			expected.WithoutDataDescriptor++
+		}
+		if i%2 == 1 {
+			expected.Skipped++
+		} else if zf.Method == zip.Deflate {
+			deflated++
+		}
+	}
+	expected.ArchivesStarted, expected.ArchivesFinished = 1, 1
+	expected.BytesIn = int64(len(zipFile))
+
+	c := &StatsCounter{}
+	z := NewReader(bytes.NewReader(zipFile), WithStats(c))
+	for i := 0; ; i++ {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if _, err := entry.Bytes(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// further calls don't count the archive again
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	// the rest of the stream is read as well
+	drainAll(t, z)
+
+	got := c.Snapshot()
+	// the pool hits depend on the other users of the pool
+	if got.PoolHits+got.PoolMisses != deflated {
+		t.Errorf("expected %d Deflate decompressors, got %d hits and %d misses", deflated, got.PoolHits, got.PoolMisses)
+	}
+	got.PoolHits, got.PoolMisses = 0, 0
+	if got != expected {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+
+	// the counter is shared by the Readers
+	zipFile, err = os.ReadFile("testdata/badcrc.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := NewReader(bytes.NewReader(zipFile), WithStats(c)).GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Bytes(); !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("expected zip.ErrChecksum, got: %v", err)
+	}
+	got = c.Snapshot()
+	if got.ChecksumFailures != 1 || got.ArchivesStarted != 2 || got.ArchivesFinished != 1 {
+		t.Fatalf("unexpected counters after a checksum failure %+v", got)
+	}
+}
+
+func TestStatsCounterDescriptor(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/descriptor.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StatsSnapshot{
+		ArchivesStarted:    1,
+		ArchivesFinished:   1,
+		BytesIn:            int64(len(zipFile)),
+		Entries:            int64(len(az.File)),
+		WithDataDescriptor: int64(len(az.File)),
+		Skipped:            2,
+	}
+	for _, zf := range az.File {
+		expected.CompressedBytes += int64(zf.CompressedSize64)
+		expected.UncompressedBytes += int64(zf.UncompressedSize64)
+	}
+
+	c := &StatsCounter{}
+	z := NewReader(bytes.NewReader(zipFile), WithStats(c))
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch entry.Name {
+		case "skipped.txt":
+			// decompressed by GetNextEntry to find the end of its data
+		case "partial.txt":
+			rc, err := entry.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rc.Read(make([]byte, 10)); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			if _, err := entry.Bytes(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	drainAll(t, z)
+
+	got := c.Snapshot()
+	// every entry is decompressed, to skip it if not to read it
+	if got.PoolHits+got.PoolMisses != int64(len(az.File)) {
+		t.Errorf("expected %d Deflate decompressors, got %d hits and %d misses", len(az.File), got.PoolHits, got.PoolMisses)
+	}
+	got.PoolHits, got.PoolMisses = 0, 0
+	if got != expected {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+// drainAll reads the rest of the stream after the entries.
+func drainAll(t *testing.T, z *Reader) {
+	rest, err := z.Drain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, rest); err != nil {
+		t.Fatal(err)
+	}
+}
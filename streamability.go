@@ -0,0 +1,67 @@
+package zipstream
+
+// StreamabilityReport classifies how friendly an entry is to streaming
+// consumers, from the local file header as it was read.
+type StreamabilityReport struct {
+	SizesInLocalHeader bool // the sizes are recorded in the local file header
+	DataDescriptor     bool // the entry is followed by a data descriptor, which a consumer must find
+	Zip64              bool // the entry has a Zip64 extra field
+	LegacyName         bool // the name isn't flagged UTF-8 but has non-ASCII bytes, its charset is unknown
+	Warnings           bool // anomalies were tolerated, see Entry.Warnings
+}
+
+// StreamabilitySummary counts the entries read per StreamabilityReport field.
+type StreamabilitySummary struct {
+	Entries            int
+	SizesInLocalHeader int
+	DataDescriptor     int
+	Zip64              int
+	LegacyName         int
+	Warnings           int
+}
+
+// StreamabilityReport returns the classification of the entry, which is set
+// once by GetNextEntry and doesn't depend on how the entry data is read.
+func (e *Entry) StreamabilityReport() StreamabilityReport {
+	return e.report
+}
+
+// Report returns the summary of the classifications of the entries read so
+// far.
+func (z *Reader) Report() StreamabilitySummary {
+	return z.report
+}
+
+// classify sets the classification of entry, whose data has not been read
+// yet, and adds it to the summary.
+func (z *Reader) classify(entry *Entry) {
+	r := StreamabilityReport{
+		SizesInLocalHeader: !entry.hasDataDescriptor() || entry.CompressedSize64 > 0 || entry.UncompressedSize64 > 0,
+		DataDescriptor:     entry.hasDataDescriptor(),
+		Zip64:              entry.zip64,
+		LegacyName:         entry.NonUTF8 && !isASCII(entry.Name),
+		Warnings:           len(entry.warnings) > 0,
+	}
+	entry.report = r
+
+	count := func(n *int, set bool) {
+		if set {
+			*n++
+		}
+	}
+	z.report.Entries++
+	count(&z.report.SizesInLocalHeader, r.SizesInLocalHeader)
+	count(&z.report.DataDescriptor, r.DataDescriptor)
+	count(&z.report.Zip64, r.Zip64)
+	count(&z.report.LegacyName, r.LegacyName)
+	count(&z.report.Warnings, r.Warnings)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
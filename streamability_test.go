@@ -0,0 +1,124 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStreamabilityReport(t *testing.T) {
+	modified := time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		contents := []byte("sized contents")
+		// sizes in the local header
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               "sized.txt",
+			Method:             zip.Store,
+			ModifiedDate:       0x5021,
+			CRC32:              crc32.ChecksumIEEE(contents),
+			CompressedSize64:   uint64(len(contents)),
+			UncompressedSize64: uint64(len(contents)),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(contents); err != nil {
+			return err
+		}
+		// sizes in the data descriptor
+		for _, name := range []string{"descriptor.txt", "opened.txt", "raw.txt"} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte("streamed contents")); err != nil {
+				return err
+			}
+		}
+		// a name in an unknown charset, and a zero MS-DOS time
+		_, err = zw.CreateRaw(&zip.FileHeader{Name: "caf\xe9.txt", Method: zip.Store})
+		return err
+	})
+
+	expected := []StreamabilityReport{
+		{SizesInLocalHeader: true},
+		{DataDescriptor: true},
+		{DataDescriptor: true},
+		{DataDescriptor: true},
+		{SizesInLocalHeader: true, LegacyName: true, Warnings: true},
+	}
+	z := NewReader(bytes.NewReader(zipFile))
+	for i, report := range expected {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.StreamabilityReport() != report {
+			t.Fatalf("entry %s: expected report %+v, got %+v", entry.Name, report, entry.StreamabilityReport())
+		}
+		// the report doesn't depend on how the data is read
+		switch i {
+		case 2:
+			_, err = entry.Bytes()
+		case 3:
+			var r io.Reader
+			if r, err = entry.OpenRaw(); err == nil {
+				_, err = io.Copy(io.Discard, r)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	expectedSummary := StreamabilitySummary{
+		Entries:            5,
+		SizesInLocalHeader: 2,
+		DataDescriptor:     3,
+		LegacyName:         1,
+		Warnings:           1,
+	}
+	if z.Report() != expectedSummary {
+		t.Fatalf("expected summary %+v, got %+v", expectedSummary, z.Report())
+	}
+}
+
+func TestStreamabilityReportZip64(t *testing.T) {
+	extra := make([]byte, 20)
+	binary.LittleEndian.PutUint16(extra, Zip64ExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 16)
+	binary.LittleEndian.PutUint64(extra[4:], 5)  // uncompressed size
+	binary.LittleEndian.PutUint64(extra[12:], 5) // compressed size
+	header := rawFileHeader(&zip.FileHeader{
+		Name:             "zip64.txt",
+		ReaderVersion:    45,
+		ModifiedDate:     0x5021,
+		CRC32:            crc32.ChecksumIEEE([]byte("hello")),
+		CompressedSize:   ^uint32(0),
+		UncompressedSize: ^uint32(0),
+		Extra:            extra,
+	})
+
+	z := NewReader(bytes.NewReader(append(header, "hello"...)), WithAllowMissingDirectory())
+	entry, err := z.GetNextEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StreamabilityReport{SizesInLocalHeader: true, Zip64: true}
+	if entry.StreamabilityReport() != expected {
+		t.Fatalf("expected report %+v, got %+v", expected, entry.StreamabilityReport())
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if z.Report() != (StreamabilitySummary{Entries: 1, SizesInLocalHeader: 1, Zip64: 1}) {
+		t.Fatalf("unexpected summary %+v", z.Report())
+	}
+}
@@ -0,0 +1,81 @@
+package zipstream
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrReadStalled is returned when a read of the source made no progress
+// within the idle timeout set by WithIdleTimeout.
+var ErrReadStalled = errors.New("zipstream: read of the source stalled")
+
+// WithIdleTimeout aborts the Reader when a single read of the source takes
+// longer than d, such as the read of a stalled upload: the read then fails
+// with ErrReadStalled, as do all the following ones. The timeout starts anew
+// with each read, including the reads of the headers and data descriptors.
+//
+// A source with a SetReadDeadline method, such as a net.Conn, gets a read
+// deadline before each read, which is cleared afterwards. Any other source is
+// read in a watchdog goroutine, started for each read, which is left blocked
+// in the source's Read when the read stalls until that Read returns; closing
+// the source, see WithOwnedSource, releases it.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(z *Reader) {
+		z.src.idle = d
+	}
+}
+
+// readDeadliner is implemented by the sources whose reads can time out
+// natively.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// readIdle reads from the source, failing with ErrReadStalled if the read
+// takes longer than the idle timeout.
+func (s *sourceReader) readIdle(p []byte) (int, error) {
+	if s.stalled {
+		return 0, ErrReadStalled
+	}
+	if d, ok := s.r.(readDeadliner); ok {
+		if err := d.SetReadDeadline(time.Now().Add(s.idle)); err != nil {
+			return 0, err
+		}
+		n, err := s.r.Read(p)
+		if isTimeout(err) {
+			s.stalled = true
+			return n, ErrReadStalled
+		}
+		if derr := d.SetReadDeadline(time.Time{}); err == nil {
+			err = derr
+		}
+		return n, err
+	}
+
+	// the watchdog reads into a buffer of its own, which a stalled read may
+	// still fill after readIdle returned
+	if cap(s.buf) < len(p) {
+		s.buf = make([]byte, len(p))
+	}
+	buf := s.buf[:len(p)]
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := s.r.Read(buf)
+		done <- readResult{n, err}
+	}()
+	timer := time.NewTimer(s.idle)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-timer.C:
+		s.stalled = true
+		s.buf = nil
+		return 0, ErrReadStalled
+	}
+}
@@ -0,0 +1,137 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deadlineConn counts the read deadlines set on a net.Conn.
+type deadlineConn struct {
+	net.Conn
+	deadlines int
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.deadlines++
+	return c.Conn.SetReadDeadline(t)
+}
+
+// stalledHeader returns the local file header of an entry whose data never
+// comes.
+func stalledHeader() []byte {
+	return rawFileHeader(&zip.FileHeader{
+		Name:             "stalled.bin",
+		ReaderVersion:    20,
+		ModifiedDate:     0x5021,
+		CompressedSize:   1 << 20,
+		UncompressedSize: 1 << 20,
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		source func(t *testing.T) (r io.Reader, w io.WriteCloser)
+	}{
+		{"watchdog", func(t *testing.T) (io.Reader, io.WriteCloser) {
+			return io.Pipe()
+		}},
+		{"read deadline", func(t *testing.T) (io.Reader, io.WriteCloser) {
+			client, server := net.Pipe()
+			conn := &deadlineConn{Conn: client}
+			t.Cleanup(func() {
+				client.Close()
+				if conn.deadlines == 0 {
+					t.Error("expected read deadlines to be set")
+				}
+			})
+			return conn, server
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, w := test.source(t)
+			defer w.Close()
+			go w.Write(stalledHeader())
+
+			z := NewReader(r, WithIdleTimeout(50*time.Millisecond))
+			entry, err := z.GetNextEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			_, err = io.Copy(io.Discard, entry)
+			if !errors.Is(err, ErrReadStalled) {
+				t.Fatalf("expected ErrReadStalled, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("the read stalled for %v", elapsed)
+			}
+			// the Reader is aborted
+			if _, err := z.GetNextEntry(); !errors.Is(err, ErrReadStalled) {
+				t.Fatalf("expected ErrReadStalled, got %v", err)
+			}
+		})
+	}
+}
+
+// slowReader returns at most chunk bytes per read, each after a delay.
+type slowReader struct {
+	r     io.Reader
+	chunk int
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	if len(p) > s.chunk {
+		p = p[:s.chunk]
+	}
+	return s.r.Read(p)
+}
+
+func TestIdleTimeoutProgress(t *testing.T) {
+	contents := strings.Repeat("0123456789", 1000)
+	zipFile := buildZip(t, func(zw *zip.Writer) error {
+		for _, name := range []string{"a.txt", "b.txt"} {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte(contents)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// the whole stream takes longer than the timeout, each read doesn't
+	src := &slowReader{r: bytes.NewReader(zipFile), chunk: 512, delay: 5 * time.Millisecond}
+	z := NewReader(src, WithIdleTimeout(50*time.Millisecond))
+	start := time.Now()
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := entry.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Fatalf("%s: unexpected contents", entry.Name)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the stream to take longer than the timeout, took %v", elapsed)
+	}
+}
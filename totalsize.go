@@ -0,0 +1,48 @@
+package zipstream
+
+import "io"
+
+// TotalUncompressedSize iterates the remaining entries and returns the sum of
+// their uncompressed sizes. The size of an entry with data descriptor is only
+// known once its data has been decompressed, which it does; the entries with
+// sizes in the local header are skipped without decompressing them.
+func (z *Reader) TotalUncompressedSize() (int64, error) {
+	var total int64
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		if entry.hasDataDescriptor() {
+			if err := entry.Skip(); err != nil {
+				return total, err
+			}
+		}
+		total += int64(entry.UncompressedSize64)
+	}
+}
+
+// TotalUncompressedSizeFast is like TotalUncompressedSize but decompresses
+// nothing: it stops at the first entry with data descriptor, whose size is
+// unknown, and returns the sum of the sizes of the entries before it with
+// partial set. The Reader is then positioned at that entry, which
+// Reader.CurrentEntry returns and which can be read or skipped before
+// iterating on with GetNextEntry.
+func (z *Reader) TotalUncompressedSizeFast() (total int64, partial bool, err error) {
+	for {
+		entry, err := z.GetNextEntry()
+		if err == io.EOF {
+			return total, false, nil
+		}
+		if err != nil {
+			return total, false, err
+		}
+		if entry.hasDataDescriptor() {
+			return total, true, nil
+		}
+		total += int64(entry.UncompressedSize64)
+	}
+}
@@ -0,0 +1,101 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTotalUncompressedSize(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/example.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	az, err := zip.NewReader(bytes.NewReader(zipFile), int64(len(zipFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected int64
+	for _, zf := range az.File {
+		expected += int64(zf.UncompressedSize64)
+	}
+
+	total, err := NewReader(bytes.NewReader(zipFile)).TotalUncompressedSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != expected {
+		t.Fatalf("expected total size %d, got %d", expected, total)
+	}
+}
+
+func TestTotalUncompressedSizeFast(t *testing.T) {
+	sizes := []int{100, 2000, 30000}
+	build := func(descriptor bool) []byte {
+		return buildZip(t, func(zw *zip.Writer) error {
+			for i, size := range sizes {
+				contents := []byte(strings.Repeat("x", size))
+				fh := &zip.FileHeader{
+					Name:               string(rune('a'+i)) + ".txt",
+					Method:             zip.Store,
+					CRC32:              crc32.ChecksumIEEE(contents),
+					CompressedSize64:   uint64(size),
+					UncompressedSize64: uint64(size),
+				}
+				var w io.Writer
+				var err error
+				if descriptor && i == 1 {
+					w, err = zw.Create(fh.Name)
+				} else {
+					w, err = zw.CreateRaw(fh)
+				}
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write(contents); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	// the second entry has a data descriptor
+	zipFile := build(true)
+
+	z := NewReader(bytes.NewReader(zipFile))
+	total, partial, err := z.TotalUncompressedSizeFast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partial || total != int64(sizes[0]) {
+		t.Fatalf("expected partial total size %d, got %d (partial %v)", sizes[0], total, partial)
+	}
+	// the entry with data descriptor is the current one
+	if entry := z.CurrentEntry(); entry == nil || entry.Name != "b.txt" {
+		t.Fatalf("expected b.txt to be the current entry, got %v", entry)
+	}
+	if b, err := z.CurrentEntry().Bytes(); err != nil || len(b) != sizes[1] {
+		t.Fatalf("read the current entry fail: %v", err)
+	}
+
+	total, err = NewReader(bytes.NewReader(zipFile)).TotalUncompressedSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != int64(sizes[0]+sizes[1]+sizes[2]) {
+		t.Fatalf("expected total size %d, got %d", sizes[0]+sizes[1]+sizes[2], total)
+	}
+
+	// without data descriptor the sum is complete
+	total, partial, err = NewReader(bytes.NewReader(build(false))).TotalUncompressedSizeFast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial || total != int64(sizes[0]+sizes[1]+sizes[2]) {
+		t.Fatalf("expected total size %d, got %d (partial %v)", sizes[0]+sizes[1]+sizes[2], total, partial)
+	}
+}
@@ -2,6 +2,10 @@ package zipstream
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -37,6 +41,59 @@ func timeZone(offset time.Duration) *time.Location {
 	return time.FixedZone("", int(offset/time.Second))
 }
 
+// isLocalName reports whether an entry name is a path local to the extraction
+// directory, on any platform: it is not absolute or rooted with a slash or a
+// backslash, has no drive letter, has no ".." element escaping the directory
+// and no NUL byte.
+func isLocalName(name string) bool {
+	if name == "" || name[0] == '/' || name[0] == '\\' || strings.IndexByte(name, 0) >= 0 {
+		return false
+	}
+	if len(name) >= 2 && name[1] == ':' && ('a' <= name[0]|0x20 && name[0]|0x20 <= 'z') {
+		return false
+	}
+	depth := 0
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch elem {
+		case ".":
+		case "..":
+			if depth--; depth < 0 {
+				return false
+			}
+		default:
+			depth++
+		}
+	}
+	return true
+}
+
+// hasReservedName reports whether an element of an entry name is a Windows
+// reserved device name. Win32 matches them case-insensitively, ignoring an
+// extension and trailing spaces, so that "aux.txt" and "Com1 .log" name
+// devices as well.
+func hasReservedName(name string) bool {
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if i := strings.IndexByte(elem, '.'); i >= 0 {
+			elem = elem[:i]
+		}
+		elem = strings.TrimRight(elem, " ")
+		switch strings.ToUpper(elem) {
+		case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+			return true
+		}
+		if len(elem) > 3 {
+			prefix := strings.ToUpper(elem[:3])
+			if prefix == "COM" || prefix == "LPT" {
+				switch elem[3:] {
+				case "1", "2", "3", "4", "5", "6", "7", "8", "9", "\u00b9", "\u00b2", "\u00b3":
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 type readBuf []byte
 
 func (b *readBuf) uint8() uint8 {
@@ -68,3 +125,54 @@ func (b *readBuf) sub(n int) readBuf {
 	*b = (*b)[n:]
 	return b2
 }
+
+// isTimeout reports whether err is a timeout, such as the expiry of the read
+// deadline of a net.Conn, after which the read can be retried.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// sanitizeName returns a relative slash-separated path derived from name
+// which stays within the extraction directory: backslashes are separators,
+// a drive letter, the leading separators, the "." elements and the ".."
+// elements escaping the directory are removed, as are NUL bytes. The trailing
+// slash of a directory is kept.
+func sanitizeName(name string) string {
+	name = strings.Replace(name, "\x00", "", -1)
+	name = strings.Replace(name, "\\", "/", -1)
+	if len(name) >= 2 && name[1] == ':' && ('a' <= name[0]|0x20 && name[0]|0x20 <= 'z') {
+		name = name[2:]
+	}
+	var elems []string
+	for _, elem := range strings.Split(name, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(elems) > 0 {
+				elems = elems[:len(elems)-1]
+			}
+		default:
+			elems = append(elems, elem)
+		}
+	}
+	sanitized := strings.Join(elems, "/")
+	if sanitized != "" && strings.HasSuffix(name, "/") {
+		sanitized += "/"
+	}
+	return sanitized
+}
+
+// humanSize formats a size in bytes with a binary unit, e.g. 1.2MiB.
+func humanSize(n uint64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	const units = "KMGTPE"
+	size, i := float64(n)/1024, 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%ciB", size, units[i])
+}
@@ -34,3 +34,110 @@ func TestReadBuf(t *testing.T) {
 	}
 
 }
+
+func TestIsLocalName(t *testing.T) {
+	tests := []struct {
+		name  string
+		local bool
+	}{
+		{"a/b/c/d/e/f.txt", true},
+		{"a/../b", true},
+		{"./a/b/", true},
+		{"ab:c", true},
+		{"../../x", false},
+		{"/etc/passwd", false},
+		{`C:\Windows\x`, false},
+		{"c:x", false},
+		{`\Windows\x`, false},
+		{"a/../../b", false},
+		{`a\..\..\b`, false},
+		{"a\x00.txt", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if local := isLocalName(test.name); local != test.local {
+			t.Errorf("isLocalName(%q) = %v, expected %v", test.name, local, test.local)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name      string
+		sanitized string
+	}{
+		{"a/b/c.txt", "a/b/c.txt"},
+		{"a/./b/", "a/b/"},
+		{"a/../b", "b"},
+		{"../../x", "x"},
+		{"/etc/passwd", "etc/passwd"},
+		{`C:\Windows\x`, "Windows/x"},
+		{"c:x", "x"},
+		{`a\..\..\b`, "b"},
+		{"a\x00.txt", "a.txt"},
+		{"../", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if sanitized := sanitizeName(test.name); sanitized != test.sanitized {
+			t.Errorf("sanitizeName(%q) = %q, expected %q", test.name, sanitized, test.sanitized)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		size string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1258291, "1.2MiB"},
+		{5 << 30, "5.0GiB"},
+		{1<<64 - 1, "16.0EiB"},
+	}
+	for _, test := range tests {
+		if size := humanSize(test.n); size != test.size {
+			t.Errorf("humanSize(%d) = %q, expected %q", test.n, size, test.size)
+		}
+	}
+}
+
+func TestHasReservedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved bool
+	}{
+		{"CON", true},
+		{"con", true},
+		{"PRN.txt", true},
+		{"aux.txt", true},
+		{"NUL", true},
+		{"nul.tar.gz", true},
+		{"com1.log", true},
+		{"COM9", true},
+		{"LPT1", true},
+		{"lpt5.txt", true},
+		{"COM¹", true},
+		{"LPT³.txt", true},
+		{"CONIN$", true},
+		{"conout$", true},
+		{"Con .txt", true},
+		{"dir/aux/file.txt", true},
+		{`dir\nul`, true},
+		{"COM0", false},
+		{"LPT10", false},
+		{"COM", false},
+		{"console", false},
+		{"null.txt", false},
+		{"auxiliary/file.txt", false},
+		{"my.con", false},
+		{"a/b/c.txt", false},
+	}
+	for _, test := range tests {
+		if reserved := hasReservedName(test.name); reserved != test.reserved {
+			t.Errorf("hasReservedName(%q) = %v, expected %v", test.name, reserved, test.reserved)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package zipstream
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCentralDirNotRead is returned by Reader.VerifyCentralDirectory when the
+// central directory has not been read, see WithCentralDirectory.
+var ErrCentralDirNotRead = errors.New("zipstream: central directory not read")
+
+// Discrepancy describes a difference between a local file header and the
+// central directory record of the same entry.
+type Discrepancy struct {
+	Name    string // name of the entry
+	Field   string // the field which differs, e.g. "crc32"
+	Local   string // the value of the local header, empty if there is none
+	Central string // the value of the central directory, empty if there is none
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%q: %s differs, local %q, central directory %q", d.Name, d.Field, d.Local, d.Central)
+}
+
+// localRecord holds the fields of a local entry checked against the central
+// directory.
+type localRecord struct {
+	Name               string
+	CRC32              uint32
+	CompressedSize64   uint64
+	UncompressedSize64 uint64
+	HeaderOffset       int64 // relative to the start of the archive
+}
+
+// VerifyCentralDirectory cross-checks the central directory against the local
+// file headers once all the entries have been read with WithCentralDirectory.
+// A mismatch of the name, CRC32, sizes or header offset, a record without
+// local header, a local header without record and a local header within the
+// central directory, see ErrInterleavedRecords, may indicate tampering.
+func (z *Reader) VerifyCentralDirectory() ([]Discrepancy, error) {
+	if !z.readCentralDir || !z.sawCentralDir {
+		return nil, ErrCentralDirNotRead
+	}
+	var discrepancies []Discrepancy
+	add := func(name, field string, local, central interface{}) {
+		discrepancies = append(discrepancies, Discrepancy{
+			Name:    name,
+			Field:   field,
+			Local:   fmt.Sprint(local),
+			Central: fmt.Sprint(central),
+		})
+	}
+
+	byName := make(map[string][]*localRecord, len(z.localRecords))
+	for i := range z.localRecords {
+		l := &z.localRecords[i]
+		byName[l.Name] = append(byName[l.Name], l)
+	}
+	matched := make(map[*localRecord]bool, len(z.localRecords))
+	for _, d := range z.centralDir {
+		var l *localRecord
+		for _, candidate := range byName[d.Name] {
+			if !matched[candidate] {
+				l = candidate
+				break
+			}
+		}
+		if l == nil {
+			discrepancies = append(discrepancies, Discrepancy{Name: d.Name, Field: "local header", Central: "present"})
+			continue
+		}
+		matched[l] = true
+		if l.CRC32 != d.CRC32 {
+			add(d.Name, "crc32", fmt.Sprintf("%08x", l.CRC32), fmt.Sprintf("%08x", d.CRC32))
+		}
+		if l.CompressedSize64 != d.CompressedSize64 {
+			add(d.Name, "compressed size", l.CompressedSize64, d.CompressedSize64)
+		}
+		if l.UncompressedSize64 != d.UncompressedSize64 {
+			add(d.Name, "uncompressed size", l.UncompressedSize64, d.UncompressedSize64)
+		}
+		// the offsets of a self-extracting archive may include the prefix
+		if d.HeaderOffset != l.HeaderOffset && d.HeaderOffset != l.HeaderOffset-z.prefixLen {
+			add(d.Name, "header offset", l.HeaderOffset, d.HeaderOffset)
+		}
+	}
+	for i := range z.localRecords {
+		if l := &z.localRecords[i]; !matched[l] {
+			discrepancies = append(discrepancies, Discrepancy{Name: l.Name, Field: "central directory record", Local: "present"})
+		}
+	}
+	if z.interleavedOffset > 0 {
+		discrepancies = append(discrepancies, Discrepancy{
+			Field: "local header within central directory",
+			Local: fmt.Sprintf("offset %d", z.interleavedOffset),
+		})
+	}
+	return discrepancies, nil
+}
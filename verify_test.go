@@ -0,0 +1,67 @@
+package zipstream
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestVerifyCentralDirectory(t *testing.T) {
+	readAll := func(zipFile []byte, opts ...Option) *Reader {
+		z := NewReader(bytes.NewReader(zipFile), opts...)
+		for {
+			if _, err := z.GetNextEntry(); err == io.EOF {
+				return z
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, name := range []string{"testdata/example.zip", "testdata/macos.zip"} {
+		zipFile, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		discrepancies, err := readAll(zipFile, WithCentralDirectory()).VerifyCentralDirectory()
+		if err != nil || len(discrepancies) != 0 {
+			t.Fatalf("%s: unexpected discrepancies %v, %v", name, discrepancies, err)
+		}
+	}
+
+	zipFile, err := os.ReadFile("testdata/sfx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	discrepancies, err := readAll(zipFile, WithCentralDirectory(), WithHeaderScan(4096)).VerifyCentralDirectory()
+	if err != nil || len(discrepancies) != 0 {
+		t.Fatalf("sfx.zip: unexpected discrepancies %v, %v", discrepancies, err)
+	}
+
+	zipFile, err = os.ReadFile("testdata/mismatch.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAll(zipFile).VerifyCentralDirectory(); err != ErrCentralDirNotRead {
+		t.Fatalf("expected ErrCentralDirNotRead, got: %v", err)
+	}
+	discrepancies, err = readAll(zipFile, WithCentralDirectory()).VerifyCentralDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Discrepancy{
+		{Name: "a.txt", Field: "crc32", Local: "13d35096", Central: "13d35069"},
+		{Name: "b.txt", Field: "uncompressed size", Local: "50", Central: "51"},
+		{Name: "x.txt", Field: "local header", Central: "present"},
+		{Name: "c.txt", Field: "central directory record", Local: "present"},
+	}
+	if len(discrepancies) != len(expected) {
+		t.Fatalf("unexpected discrepancies %v", discrepancies)
+	}
+	for i, d := range discrepancies {
+		if d != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], d)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package zipstream
+
+import "fmt"
+
+// WarningCode identifies the kind of a ParseWarning.
+type WarningCode string
+
+// The codes of the tolerated anomalies reported as warnings.
+const (
+	WarnTruncatedExtra      WarningCode = "truncated-extra"      // an extra field declares more bytes than the extra area holds
+	WarnExtraTrailingData   WarningCode = "extra-trailing-data"  // bytes too short for an extra field header end the extra area
+	WarnZeroDOSTime         WarningCode = "zero-dos-time"        // the MS-DOS modification date and time are zero
+	WarnInvalidUTF8Name     WarningCode = "invalid-utf8-name"    // the name is flagged UTF-8 but isn't valid UTF-8
+	WarnPrefixSkipped       WarningCode = "prefix-skipped"       // bytes before the first local file header were skipped
+	WarnPaddingSkipped      WarningCode = "padding-skipped"      // zero bytes between entries were skipped
+	WarnArchiveBoundary     WarningCode = "archive-boundary"     // another archive starts, see WithConcatenatedArchives
+	WarnDuplicateName       WarningCode = "duplicate-name"       // the name collides with a previous one, see WithDuplicateDetection
+	WarnInterstitialSkipped WarningCode = "interstitial-skipped" // bytes between entries were skipped, see Reader.SetEntrySignatureScan
+	WarnManifestMismatch    WarningCode = "manifest-mismatch"    // the entry doesn't match the manifest, see WithManifest
+	WarnReaderVersion       WarningCode = "reader-version"       // the version needed to extract is above 6.3, an error in strict mode
+	WarnEmptyName           WarningCode = "empty-name"           // the file name is empty, an error in strict mode
+)
+
+// ParseWarning describes an anomaly of the archive which was tolerated.
+type ParseWarning struct {
+	Code   WarningCode
+	Offset int64 // stream offset of the anomaly
+	Msg    string
+}
+
+func (w ParseWarning) String() string {
+	return fmt.Sprintf("%s at offset %d: %s", w.Code, w.Offset, w.Msg)
+}
+
+// Warnings returns the anomalies tolerated while parsing the local file
+// header of the entry.
+func (e *Entry) Warnings() []ParseWarning {
+	return e.warnings
+}
+
+// Warnings returns the anomalies tolerated so far which are not related to a
+// single entry, such as a skipped prefix or inter-entry padding.
+func (z *Reader) Warnings() []ParseWarning {
+	return z.warnings
+}
+
+func (e *Entry) warn(code WarningCode, offset int64, format string, args ...interface{}) {
+	e.warnings = append(e.warnings, ParseWarning{Code: code, Offset: offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (z *Reader) warn(code WarningCode, offset int64, format string, args ...interface{}) {
+	z.warnings = append(z.warnings, ParseWarning{Code: code, Offset: offset, Msg: fmt.Sprintf(format, args...)})
+}
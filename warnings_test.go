@@ -0,0 +1,90 @@
+package zipstream
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestEntryWarnings(t *testing.T) {
+	var archive bytes.Buffer
+	// zero MS-DOS time and an extended timestamp field declaring 9 bytes
+	// of which 5 follow
+	archive.Write(rawFileHeader(&zip.FileHeader{
+		Name:          "a.txt",
+		ReaderVersion: 20,
+		Extra:         []byte{0x55, 0x54, 0x09, 0x00, 0x01, 0x00, 0xe0, 0xd9, 0x63},
+	}))
+	// a name flagged UTF-8 which isn't, and 2 bytes after the last field
+	archive.Write(rawFileHeader(&zip.FileHeader{
+		Name:          "b\xff.txt",
+		ReaderVersion: 20,
+		Flags:         0x800,
+		ModifiedDate:  0x5021,
+		Extra:         []byte{0x00, 0x00},
+	}))
+	archive.Write(rawFileHeader(&zip.FileHeader{
+		Name:          "c.txt",
+		ReaderVersion: 20,
+		ModifiedDate:  0x5021,
+	}))
+
+	expected := [][]WarningCode{
+		{WarnTruncatedExtra, WarnZeroDOSTime},
+		{WarnInvalidUTF8Name, WarnExtraTrailingData},
+		nil,
+	}
+	z := NewReader(bytes.NewReader(archive.Bytes()), WithAllowMissingDirectory())
+	for i, codes := range expected {
+		entry, err := z.GetNextEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings := entry.Warnings()
+		if len(warnings) != len(codes) {
+			t.Fatalf("entry %d: unexpected warnings %v", i, warnings)
+		}
+		for j, w := range warnings {
+			if w.Code != codes[j] || w.Msg == "" {
+				t.Fatalf("entry %d: unexpected warning %v", i, w)
+			}
+		}
+	}
+	if _, err := z.GetNextEntry(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if len(z.Warnings()) != 0 {
+		t.Fatalf("unexpected reader warnings %v", z.Warnings())
+	}
+}
+
+func TestReaderWarnings(t *testing.T) {
+	zipFile, err := os.ReadFile("testdata/sfx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := NewReader(bytes.NewReader(zipFile), WithHeaderScan(4096))
+	if _, err := z.GetNextEntry(); err != nil {
+		t.Fatal(err)
+	}
+	warnings := z.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != WarnPrefixSkipped || warnings[0].Offset != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	first := rawFileHeader(&zip.FileHeader{Name: "a.txt", ReaderVersion: 20, ModifiedDate: 0x5021})
+	padded := append(append(append([]byte(nil), first...), make([]byte, 6)...),
+		rawFileHeader(&zip.FileHeader{Name: "b.txt", ReaderVersion: 20, ModifiedDate: 0x5021})...)
+	z = NewReader(bytes.NewReader(padded), WithInterEntryPadding(16))
+	for i := 0; i < 2; i++ {
+		if _, err := z.GetNextEntry(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	warnings = z.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != WarnPaddingSkipped || warnings[0].Offset != int64(len(first)) {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}